@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"encoding/base64"
+	"errors"
 	"encoding/hex"
 	"fmt"
 	"math"
@@ -12,11 +13,31 @@ import (
 	"sync"
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/ecdsa"
+	cryptorand "crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/url"
+	"sort"
 	"syscall/js"
 	"time"
 )
 
-// [[USER_MOD_STRATEGIES]]
+// UserMod is a strategy compiled in from the User Mods tab. The compile server builds
+// each mod as a separate file next to this one, which registers it from an init function.
+type UserMod struct {
+	Key         string              `json:"key"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Params      json.RawMessage     `json:"params"` // Parameter schema for the UI
+	Strategy    ModStrategyFunction `json:"-"`
+}
+
+// userMods holds the compiled mods in registration order.
+var userMods []UserMod
+
+func registerUserMod(m UserMod) { userMods = append(userMods, m) }
 
 type Config struct {
 	Symbol              string            `json:"symbol"`
@@ -27,6 +48,45 @@ type Config struct {
 	Strategy            string            `json:"strategy"`
 	StrategyParams      map[string]float64 `json:"strategyParams"`
 	RiskLevel           string            `json:"riskLevel"`
+	RecordMarketData    bool              `json:"recordMarketData"`
+	FeedTimeoutSeconds  int               `json:"feedTimeoutSeconds"` // Pause trading when no market data arrives for this long
+	MaxPriceAgeSeconds  int               `json:"maxPriceAgeSeconds"` // Skip ticks whose last trade is older than this
+	Costs               CostConfig        `json:"costs"`
+	OrderBook           bool              `json:"orderBook"` // Maintain an L2 order book where the connector supports it
+	ConfirmLiveTrading  bool              `json:"confirmLiveTrading"` // Required to send real orders to a production environment
+}
+
+// Connector environments, chosen with the "environment" connector param.
+const (
+	EnvProduction = "production"
+	EnvTestnet    = "testnet" // Binance Spot Test Network
+	EnvSandbox    = "sandbox" // Coinbase Advanced Trade sandbox
+)
+
+// Environment returns the connector environment, defaulting to production.
+func (c Config) Environment() string {
+	env := strings.ToLower(strings.TrimSpace(c.ConnectorParams["environment"]))
+	if env == "" {
+		return EnvProduction
+	}
+	return env
+}
+
+// LiveProduction reports whether the config would send real orders to a real account.
+func (c Config) LiveProduction() bool {
+	return !c.PaperTrading && c.Connector != "simulation" && c.Environment() == EnvProduction
+}
+
+// CostConfig overrides the connector's default fee schedule and slippage model.
+// Unset values keep the exchange defaults; 0 is a valid override for any of them.
+type CostConfig struct {
+	MakerFee        *float64 `json:"makerFee,omitempty"` // Fraction, e.g. 0.001 for 0.1%; 0 is a valid override
+	TakerFee        *float64 `json:"takerFee,omitempty"`
+	PayFeesInBNB    bool     `json:"payFeesInBNB"`              // Binance only
+	SlippageModel   string   `json:"slippageModel"`             // "fixed", "spread" or "volume"
+	SlippageBps     *float64 `json:"slippageBps,omitempty"`     // Fixed model
+	SpreadBps       *float64 `json:"spreadBps,omitempty"`       // Spread model: assumed quoted spread
+	ImpactBpsPer10k *float64 `json:"impactBpsPer10k,omitempty"` // Volume model: bps per $10k notional
 }
 
 type BotState struct {
@@ -35,6 +95,15 @@ type BotState struct {
 	stopChannel    chan bool
 	prices         []float64
 	connector      Connector
+	paper          *PaperExchange
+	balances       map[string]float64
+	position       Position
+	feedStale      bool
+	priceStale     bool
+	book           BookTop // Latest order book summary; only meaningful while bookReady
+	bookReady      bool
+	managed        ManagedStrategy // Set when the selected strategy works its own orders
+	orders         OrderManager
 	lastShortSMA   float64
 	lastLongSMA    float64
 	lastRSI        float64
@@ -45,419 +114,3304 @@ type BotState struct {
 	initialEquity  float64
 	startTime      time.Time
 	lastPriceAlert float64
+	resume         *EngineState // Imported from a previous module; picked up by the next start
 }
 
 type Connector interface {
 	Connect(paperTrading bool, symbol string) error
-	GetPrice() (float64, error)
+	GetQuote() (Quote, error)
 	PlaceOrder(bs *BotState, signal Signal, price float64, symbol string) error
 	Disconnect() error
+	Market() Market
+	GetBalances() (map[string]float64, error) // Available (unlocked) amount per asset
+	FeedHealthy(maxSilence time.Duration) bool // False once the price feed has been silent for maxSilence
 }
 
-type SimulationConnector struct{ lastPrice float64; volatility float64 }
+// OrderBookConnector is implemented by connectors that can maintain a local L2 book.
+// OrderBook reports false until the book has synced (or after it lost sequence).
+type OrderBookConnector interface {
+	Connector
+	OrderBook() (BookTop, bool)
+}
 
-func (sc *SimulationConnector) Connect(paperTrading bool, symbol string) error {
-	logMessage("info", "Simulation Connector Initialized.")
-	sc.lastPrice = 100.0 + rand.Float64()*50.0
-	sc.volatility = 0.02 + rand.Float64()*0.03
+// DerivativesConnector is implemented by connectors that trade perpetual futures,
+// where positions can be short and are opened with leverage.
+type DerivativesConnector interface {
+	Connector
+	GetPosition() (Position, error)
+	FundingRate() (float64, time.Time) // Current rate and next settlement time
+	Leverage() float64
+}
+
+// ClockedConnector is implemented by connectors that measure how far the local clock is
+// from the exchange's, so exchange timestamps can be compared with local time.
+type ClockedConnector interface {
+	Connector
+	ClockOffset() time.Duration // Exchange time minus local time
+}
+
+// Quote is the latest traded price together with the exchange time it was reported at.
+type Quote struct {
+	Price float64
+	Time  time.Time
+}
+
+// MarketEvent is a single raw trade or ticker update received from a connector.
+// Recorded events are stored one JSON object per line so they can be replayed later.
+type MarketEvent struct {
+	Timestamp int64   `json:"ts"` // Exchange event time, Unix milliseconds
+	Exchange  string  `json:"exchange"`
+	Symbol    string  `json:"symbol"`
+	Type      string  `json:"type"` // "trade" or "ticker"
+	Price     float64 `json:"price"`
+	Size      float64 `json:"size"`
+	Side      string  `json:"side"`
+}
+
+type MarketRecorder interface {
+	Record(ev MarketEvent)
+	Flush() error
+}
+
+// IndexedDBRecorder buffers events and hands them to the page in batches,
+// which stores them in IndexedDB partitioned by exchange, symbol and UTC day.
+type IndexedDBRecorder struct {
+	buffer    []MarketEvent
+	batchSize int
+	lastFlush time.Time
+	mu        sync.Mutex
+}
+
+func NewIndexedDBRecorder() *IndexedDBRecorder {
+	return &IndexedDBRecorder{batchSize: 50, lastFlush: time.Now()}
+}
+
+func (r *IndexedDBRecorder) Record(ev MarketEvent) {
+	r.mu.Lock()
+	r.buffer = append(r.buffer, ev)
+	full := len(r.buffer) >= r.batchSize || time.Since(r.lastFlush) > 5*time.Second
+	r.mu.Unlock()
+	if full {
+		r.Flush()
+	}
+}
+
+func (r *IndexedDBRecorder) Flush() error {
+	r.mu.Lock()
+	events := r.buffer
+	r.buffer = nil
+	r.lastFlush = time.Now()
+	r.mu.Unlock()
+	if len(events) == 0 {
+		return nil
+	}
+	jsonData, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("failed to encode market events: %w", err)
+	}
+	js.Global().Call("goRecordMarketEvents", string(jsonData))
 	return nil
 }
-func (sc *SimulationConnector) GetPrice() (float64, error) {
-	trend := math.Sin(float64(time.Now().Unix())/100.0) * 0.001
-	noise := (rand.Float64() - 0.5) * sc.volatility
-	change := trend + noise
-	sc.lastPrice *= (1 + change)
-	if sc.lastPrice < 10 {
-		sc.lastPrice = 10.0
+
+// recordEvent is a no-op when recording is disabled for the connector.
+func recordEvent(r MarketRecorder, ev MarketEvent) {
+	if r != nil {
+		r.Record(ev)
 	}
-	if sc.lastPrice > 1000 {
-		sc.lastPrice = 1000.0
+}
+
+func flushRecorder(r MarketRecorder) {
+	if r == nil {
+		return
+	}
+	if err := r.Flush(); err != nil {
+		logMessage("error", "Failed to flush recorded market data: "+err.Error())
 	}
-	return sc.lastPrice, nil
 }
-func (sc *SimulationConnector) PlaceOrder(bs *BotState, signal Signal, price float64, symbol string) error {
-	orderType := "HOLD"
-	if signal == BUY {
-		orderType = "BUY"
+
+var quoteAssets = []string{"USDT", "USDC", "BUSD", "USD", "EUR", "GBP", "BTC", "ETH", "BNB"}
+
+// splitSymbol splits a concatenated pair such as "BTCUSDT" into its base and quote assets.
+func splitSymbol(symbol string) (string, string) {
+	symbol = strings.ToUpper(strings.Replace(symbol, "-", "", -1))
+	for _, q := range quoteAssets {
+		if strings.HasSuffix(symbol, q) && len(symbol) > len(q) {
+			return symbol[:len(symbol)-len(q)], q
+		}
 	}
-	if signal == SELL {
-		orderType = "SELL"
+	return symbol, "USD"
+}
+
+// orderQuoteAmount is the fixed quote amount traded per signal for a risk level.
+func orderQuoteAmount(riskLevel string) float64 {
+	switch riskLevel {
+	case "conservative":
+		return 10.0
+	case "aggressive":
+		return 50.0
 	}
-	logMessage("success", fmt.Sprintf("[PAPER TRADE] Placed %s order for %s at $%.2f", orderType, symbol, price))
-	return nil
+	return 20.0 // Moderate
 }
-func (sc *SimulationConnector) Disconnect() error { return nil }
 
-type CoinbaseConnector struct {
-	apiKey       string
-	apiSecret    string
-	secretPhrase string
-	isPaperTrade bool
-	ws           js.Value
-	lastPrice    float64
-	mu           sync.Mutex
+// Market is an exchange-neutral description of a tradable pair and its order filters.
+type Market struct {
+	Symbol         string // Bot symbol, e.g. "BTCUSDT"
+	ExchangeSymbol string // Exchange-native symbol, e.g. "BTC-USD" on Coinbase
+	Base           string
+	Quote          string
+	TickSize       float64 // Price increment
+	StepSize       float64 // Quantity increment
+	MinQty         float64
+	MinNotional    float64
+	QuoteStep      float64 // Increment for quote-denominated order amounts
 }
 
-func (cc *CoinbaseConnector) Connect(paperTrading bool, symbol string) error {
-	logMessage("info", "Coinbase Connector Initializing...")
-	cc.isPaperTrade = paperTrading
-	if !paperTrading && (cc.apiKey == "" || cc.apiSecret == "" || cc.secretPhrase == "") {
-		return fmt.Errorf("API Key, Secret, or Passphrase is missing for Coinbase")
+// stepPrecision is the number of decimals needed to print a value rounded to step.
+func stepPrecision(step float64) int {
+	if step <= 0 || step >= 1 {
+		return 0
 	}
+	return int(math.Round(-math.Log10(step)))
+}
 
-	wsURL := "wss://ws-feed.pro.coinbase.com"
-	logMessage("info", "Connecting to Coinbase WebSocket: "+wsURL)
+func roundDown(v, step float64) float64 {
+	if step <= 0 {
+		return v
+	}
+	return math.Floor(v/step+1e-9) * step
+}
 
-	ws := js.Global().Get("WebSocket").New(wsURL)
-	cc.ws = ws
+func (m Market) RoundPrice(p float64) float64    { return roundDown(p, m.TickSize) }
+func (m Market) RoundQuantity(q float64) float64 { return roundDown(q, m.StepSize) }
+func (m Market) RoundQuote(q float64) float64    { return roundDown(q, m.QuoteStep) }
 
-	connected := make(chan bool)
-	var onOpen, onMessage, onError, onClose js.Func
+func (m Market) FormatQuantity(q float64) string {
+	return strconv.FormatFloat(m.RoundQuantity(q), 'f', stepPrecision(m.StepSize), 64)
+}
 
-	onOpen = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-		logMessage("success", "Coinbase WebSocket connection established.")
-		// Coinbase requires a subscription message after connecting.
-		// Symbol format needs to be like "BTC-USD"
-		coinbaseSymbol := strings.Replace(strings.ToUpper(symbol), "USDT", "-USD", 1)
-
-		subMsg := map[string]interface{}{
-			"type":        "subscribe",
-			"product_ids": []string{coinbaseSymbol},
-			"channels":    []string{"ticker"},
-		}
-		subMsgJSON, _ := json.Marshal(subMsg)
-		ws.Call("send", string(subMsgJSON))
-		logMessage("info", fmt.Sprintf("Subscribed to Coinbase ticker for %s", coinbaseSymbol))
-		connected <- true
-		return nil
-	})
-	ws.Set("onopen", onOpen)
+func (m Market) FormatPrice(p float64) string {
+	return strconv.FormatFloat(m.RoundPrice(p), 'f', stepPrecision(m.TickSize), 64)
+}
 
-	onMessage = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-		event := args[0]
-		data := event.Get("data").String()
-		var tickerData map[string]interface{}
-		if err := json.Unmarshal([]byte(data), &tickerData); err != nil {
-			// Coinbase sends non-JSON heartbeats, we can ignore parse errors on those.
-			return nil
-		}
-		// Check if it's a ticker update
-		if t, ok := tickerData["type"].(string); ok && t == "ticker" {
-			if priceStr, ok := tickerData["price"].(string); ok {
-				if price, err := strconv.ParseFloat(priceStr, 64); err == nil {
-					cc.mu.Lock()
-					cc.lastPrice = price
-					cc.mu.Unlock()
-				}
-			}
-		}
-		return nil
-	})
-	ws.Set("onmessage", onMessage)
+func (m Market) FormatQuote(q float64) string {
+	return strconv.FormatFloat(m.RoundQuote(q), 'f', stepPrecision(m.QuoteStep), 64)
+}
 
-	onError = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-		logMessage("error", "Coinbase WebSocket error.")
+// ValidateOrder checks a rounded order against the exchange's quantity and notional filters.
+func (m Market) ValidateOrder(qty, price float64) error {
+	if m.MinQty > 0 && qty < m.MinQty {
+		return fmt.Errorf("quantity %s below minimum %s for %s", m.FormatQuantity(qty), m.FormatQuantity(m.MinQty), m.Symbol)
+	}
+	if m.MinNotional > 0 && qty*price < m.MinNotional {
+		return fmt.Errorf("order value $%.2f below minimum notional $%.2f for %s", qty*price, m.MinNotional, m.Symbol)
+	}
+	return nil
+}
+
+// awaitPromise blocks until p settles. It must be called from a goroutine,
+// never from inside a JS callback, or the event loop deadlocks.
+func awaitPromise(p js.Value) (js.Value, error) {
+	done := make(chan struct{})
+	var result js.Value
+	var err error
+	onFulfilled := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		result = args[0]
+		close(done)
 		return nil
 	})
-	ws.Set("onerror", onError)
-
-	onClose = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-		logMessage("warning", "Coinbase WebSocket connection closed.")
-		onOpen.Release()
-		onMessage.Release()
-		onError.Release()
-		this.Release()
+	onRejected := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		err = fmt.Errorf("%s", args[0].Call("toString").String())
+		close(done)
 		return nil
 	})
-	ws.Set("onclose", onClose)
+	defer onFulfilled.Release()
+	defer onRejected.Release()
+	p.Call("then", onFulfilled, onRejected)
+	<-done
+	return result, err
+}
 
-	select {
-	case <-connected:
-		return nil
-	case <-time.After(10 * time.Second):
-		return fmt.Errorf("Coinbase WebSocket connection timed out")
-	}
+// fetchJSON performs a fetch and decodes the JSON body into out, returning the HTTP status.
+func fetchJSON(url string, reqOptions js.Value, out interface{}) (int, error) {
+	status, _, err := fetchJSONWithHeaders(url, reqOptions, out)
+	return status, err
 }
 
-func (cc *CoinbaseConnector) GetPrice() (float64, error) {
-	cc.mu.Lock()
-	defer cc.mu.Unlock()
-	if cc.lastPrice == 0 {
-		return 0, fmt.Errorf("price not available yet from Coinbase WebSocket")
+// fetchJSONWithHeaders is fetchJSON that also returns the response's Headers object,
+// for exchanges that report rate-limit usage in headers.
+func fetchJSONWithHeaders(url string, reqOptions js.Value, out interface{}) (int, js.Value, error) {
+	var promise js.Value
+	if reqOptions.IsUndefined() {
+		promise = js.Global().Call("fetch", url)
+	} else {
+		promise = js.Global().Call("fetch", url, reqOptions)
 	}
-	return cc.lastPrice, nil
+	response, err := awaitPromise(promise)
+	if err != nil {
+		return 0, js.Undefined(), fmt.Errorf("network error: %w", err)
+	}
+	status := response.Get("status").Int()
+	headers := response.Get("headers")
+	body, err := awaitPromise(response.Call("text"))
+	if err != nil {
+		return status, headers, fmt.Errorf("failed to read response: %w", err)
+	}
+	if out != nil {
+		if err := json.Unmarshal([]byte(body.String()), out); err != nil {
+			return status, headers, fmt.Errorf("invalid JSON response: %w", err)
+		}
+	}
+	return status, headers, nil
 }
 
-func (cc *CoinbaseConnector) PlaceOrder(bs *BotState, signal Signal, price float64, symbol string) error {
-	if cc.isPaperTrade {
-		orderType := "HOLD"
-		if signal == BUY {
-			orderType = "BUY"
-		}
-		if signal == SELL {
-			orderType = "SELL"
+func parseFloatOrZero(s string) float64 {
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
+
+type FeeTier struct {
+	MinVolume float64 // Trailing 30-day quote volume
+	MakerRate float64
+	TakerRate float64
+}
+
+// FeeSchedule describes an exchange's maker/taker rates. Tiers, when present,
+// are ordered by ascending MinVolume and take precedence over the flat rates.
+type FeeSchedule struct {
+	MakerRate   float64
+	TakerRate   float64
+	BNBDiscount float64 // Fraction taken off fees when paying in BNB
+	PayInBNB    bool
+	Tiers       []FeeTier
+}
+
+func (fs FeeSchedule) Rate(liquidity string, volume30d float64) float64 {
+	maker, taker := fs.MakerRate, fs.TakerRate
+	for _, t := range fs.Tiers {
+		if volume30d >= t.MinVolume {
+			maker, taker = t.MakerRate, t.TakerRate
 		}
-		logMessage("success", fmt.Sprintf("[PAPER TRADE] Placed %s order for %s at $%.2f", orderType, symbol, price))
-		return nil
 	}
+	rate := taker
+	if liquidity == "maker" {
+		rate = maker
+	}
+	if fs.PayInBNB {
+		rate *= 1 - fs.BNBDiscount
+	}
+	return rate
+}
 
-	if cc.apiKey == "" || cc.apiSecret == "" || cc.secretPhrase == "" {
-		err := fmt.Errorf("cannot place real order: Coinbase API Key, Secret, or Passphrase is missing")
-		logMessage("error", err.Error())
-		return err
+// SlippageModel estimates the adverse price move, as a fraction, of a market order.
+type SlippageModel struct {
+	Model           string
+	FixedBps        float64
+	SpreadBps       float64
+	ImpactBpsPer10k float64
+}
+
+func (sm SlippageModel) Slippage(notional float64) float64 {
+	switch sm.Model {
+	case "spread":
+		// Crossing the book costs half the quoted spread.
+		return sm.SpreadBps / 2 / 10000
+	case "volume":
+		return (sm.SpreadBps/2 + sm.ImpactBpsPer10k*notional/10000) / 10000
 	}
+	return sm.FixedBps / 10000
+}
 
-	go func() {
-		side := "buy"
-		if signal == SELL {
-			side = "sell"
-		}
+type CostModel struct {
+	Fees     FeeSchedule
+	Slippage SlippageModel
+}
 
-		coinbaseSymbol := strings.Replace(strings.ToUpper(symbol), "USDT", "-USD", 1)
+// defaultFeeSchedule returns the published retail fee schedule for a connector.
+func defaultFeeSchedule(connector string) FeeSchedule {
+	switch connector {
+	case "binance":
+		return FeeSchedule{MakerRate: 0.001, TakerRate: 0.001, BNBDiscount: 0.25}
+	case "bybit":
+		return FeeSchedule{MakerRate: 0.0002, TakerRate: 0.00055}
+	case "kraken":
+		return FeeSchedule{MakerRate: 0.0025, TakerRate: 0.004, Tiers: []FeeTier{
+			{MinVolume: 0, MakerRate: 0.0025, TakerRate: 0.004},
+			{MinVolume: 10000, MakerRate: 0.002, TakerRate: 0.0035},
+			{MinVolume: 50000, MakerRate: 0.0014, TakerRate: 0.0024},
+			{MinVolume: 100000, MakerRate: 0.0012, TakerRate: 0.0022},
+			{MinVolume: 250000, MakerRate: 0.001, TakerRate: 0.002},
+			{MinVolume: 500000, MakerRate: 0.0008, TakerRate: 0.0018},
+			{MinVolume: 1000000, MakerRate: 0.0006, TakerRate: 0.0016},
+		}}
+	case "coinbase":
+		return FeeSchedule{MakerRate: 0.004, TakerRate: 0.006, Tiers: []FeeTier{
+			{MinVolume: 0, MakerRate: 0.004, TakerRate: 0.006},
+			{MinVolume: 10000, MakerRate: 0.0025, TakerRate: 0.004},
+			{MinVolume: 50000, MakerRate: 0.0015, TakerRate: 0.0025},
+			{MinVolume: 100000, MakerRate: 0.001, TakerRate: 0.002},
+			{MinVolume: 1000000, MakerRate: 0.0008, TakerRate: 0.0018},
+		}}
+	}
+	return FeeSchedule{MakerRate: 0.001, TakerRate: 0.001}
+}
 
-		quoteOrderQty := "20.00" // Moderate
-		switch bs.config.RiskLevel {
-		case "conservative":
-			quoteOrderQty = "10.00"
-		case "aggressive":
-			quoteOrderQty = "50.00"
+// newCostModel combines the connector defaults with any overrides from the config.
+func newCostModel(config Config) CostModel {
+	c := config.Costs
+	fees := defaultFeeSchedule(config.Connector)
+	// Each rate is overridden on its own. A rate that is not overridden keeps its volume
+	// tiers; the tiers go only once neither rate uses them.
+	if c.MakerFee != nil && c.TakerFee != nil {
+		fees.Tiers = nil
+	}
+	if c.MakerFee != nil || c.TakerFee != nil {
+		tiers := append([]FeeTier(nil), fees.Tiers...)
+		for i := range tiers {
+			if c.MakerFee != nil {
+				tiers[i].MakerRate = *c.MakerFee
+			}
+			if c.TakerFee != nil {
+				tiers[i].TakerRate = *c.TakerFee
+			}
 		}
+		fees.Tiers = tiers
+	}
+	if c.MakerFee != nil {
+		fees.MakerRate = *c.MakerFee
+	}
+	if c.TakerFee != nil {
+		fees.TakerRate = *c.TakerFee
+	}
+	fees.PayInBNB = c.PayFeesInBNB && config.Connector == "binance"
 
-		orderBody := map[string]string{"product_id": coinbaseSymbol, "side": side, "type": "market", "funds": quoteOrderQty}
-		if side == "sell" {
-			logMessage("warning", "Coinbase market SELL orders require 'size' (amount of crypto). This is not implemented. Order will likely fail.")
-			delete(orderBody, "funds")
-			orderBody["size"] = "0.001" // Dummy value for demonstration
-		}
+	slippage := SlippageModel{Model: c.SlippageModel, FixedBps: 5, SpreadBps: 2, ImpactBpsPer10k: 1}
+	if slippage.Model == "" {
+		slippage.Model = "fixed"
+	}
+	if c.SlippageBps != nil {
+		slippage.FixedBps = *c.SlippageBps
+	}
+	if c.SpreadBps != nil {
+		slippage.SpreadBps = *c.SpreadBps
+	}
+	if c.ImpactBpsPer10k != nil {
+		slippage.ImpactBpsPer10k = *c.ImpactBpsPer10k
+	}
+	return CostModel{Fees: fees, Slippage: slippage}
+}
 
-		bodyBytes, _ := json.Marshal(orderBody)
-		bodyString := string(bodyBytes)
+type OrderType string
 
-		timestamp := fmt.Sprintf("%d", time.Now().Unix())
-		method := "POST"
-		requestPath := "/orders"
-		prehash := timestamp + method + requestPath + bodyString
-		decodedSecret, err := base64.StdEncoding.DecodeString(cc.apiSecret)
-		if err != nil {
-			logMessage("error", "Failed to decode Coinbase API secret.")
-			return
-		}
+const (
+	MarketOrder OrderType = "MARKET"
+	LimitOrder  OrderType = "LIMIT"
+)
 
-		mac := hmac.New(sha256.New, decodedSecret)
-		mac.Write([]byte(prehash))
-		signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+// Order is a resting limit order worked by an order-managing strategy.
+type Order struct {
+	ID       string
+	Side     Signal
+	Price    float64
+	Quantity float64
+	Fee      float64   // Quote asset, known once filled
+	Time     time.Time // Placement time, or fill time for orders returned by PollFills
+}
 
-		endpoint := "https://api.pro.coinbase.com"
-		url := endpoint + requestPath
+// OrderManager places and tracks resting limit orders. The paper exchange implements
+// it for every connector; live support depends on the connector.
+type OrderManager interface {
+	// PlaceMarketOrder fills immediately, sized by quoteQty or, when set, by quantity.
+	PlaceMarketOrder(side Signal, quoteQty, quantity float64) (Order, error)
+	PlaceLimitOrder(side Signal, price, quantity float64) (Order, error)
+	CancelOrder(id string) error
+	PollFills() ([]Order, error)  // Orders that filled completely since the last call
+	Reserved() map[string]float64 // Funds held by open orders, per asset
+}
 
-		headers := js.Global().Get("Object").New()
-		headers.Set("Content-Type", "application/json")
-		headers.Set("CB-ACCESS-KEY", cc.apiKey)
-		headers.Set("CB-ACCESS-SIGN", signature)
-		headers.Set("CB-ACCESS-TIMESTAMP", timestamp)
-		headers.Set("CB-ACCESS-PASSPHRASE", cc.secretPhrase)
+// Exchange rejections that callers may want to react to, independent of the connector.
+// Connector errors wrap these so they can be tested with errors.Is.
+var (
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrFilterFailure       = errors.New("order violates exchange filters")
+	ErrRateLimited         = errors.New("exchange rate limit reached")
+	ErrTimestampOutOfSync  = errors.New("request timestamp outside receive window")
+)
 
-		reqOptions := js.Global().Get("Object").New()
-		reqOptions.Set("method", method)
-		reqOptions.Set("headers", headers)
-		reqOptions.Set("body", bodyString)
+type OrderRequest struct {
+	Symbol     string
+	Side       Signal
+	Type       OrderType
+	QuoteQty   float64 // Amount of quote asset to spend (BUY) or receive (SELL)
+	Quantity   float64 // Base quantity; takes precedence over QuoteQty when set
+	ReduceOnly bool    // Derivatives only: the order may only shrink the open position
+}
 
-		logMessage("info", fmt.Sprintf("[REAL TRADE] Submitting Coinbase %s market order for %s...", side, coinbaseSymbol))
+// Position is a derivatives position. Size is signed: positive long, negative short.
+type Position struct {
+	Size       float64
+	EntryPrice float64
+}
 
-		fetchPromise := js.Global().Call("fetch", url, reqOptions)
-		fetchPromise.Call("then", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-			response := args[0]
-			response.Call("json").Call("then", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-				resultJSON, _ := js.Global().Get("JSON").Call("stringify", args[0], nil, 2).String()
-				if response.Get("ok").Bool() {
-					logMessage("success", fmt.Sprintf("Coinbase order successful:\n%s", resultJSON))
-				} else {
-					logMessage("error", fmt.Sprintf("Coinbase API Error:\n%s", resultJSON))
-				}
-				return nil
-			}))
-			return nil
-		})).Call("catch", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-			logMessage("error", fmt.Sprintf("Network error during Coinbase trade execution: %v", args[0]))
-			return nil
-		}))
-	}()
+type Fill struct {
+	Symbol    string
+	Side      Signal
+	Price     float64
+	Quantity  float64
+	Fee       float64 // Charged in the quote asset
+	Liquidity string  // "maker" or "taker"
+	Time      time.Time
+}
 
-	return nil
+// PaperExchange is a virtual exchange used by every connector in paper mode.
+// It keeps per-asset balances, fills orders against live prices after a simulated
+// latency, applies slippage and fees, and rejects orders that cannot be funded.
+type PaperExchange struct {
+	balances map[string]float64
+	base     string
+	quote    string
+	market   Market // Filters applied to paper orders so they match the live exchange
+	costs    CostModel
+	latency  time.Duration
+	fills    []Fill
+	volume   float64 // Traded quote volume, used for fee tiers
+	feesPaid float64
+	// Derivatives mode, enabled when leverage > 0
+	leverage   float64
+	position   float64
+	entryPrice float64
+	// Resting limit orders (spot only) and the funds they hold
+	openOrders  map[string]restingOrder
+	locked      map[string]float64
+	limitFills  []Order
+	nextOrderID int
+	markPrice   float64 // Last price seen by MatchLimitOrders; market orders fill from it
+	mu          sync.Mutex
 }
-func (cc *CoinbaseConnector) Disconnect() error { return nil }
 
-type BinanceConnector struct {
-	apiKey       string
-	apiSecret    string
-	isPaperTrade bool
-	ws           js.Value
-	lastPrice    float64
-	mu           sync.Mutex
+func NewPaperExchange(symbol string, startingQuote float64, costs CostModel) *PaperExchange {
+	base, quote := splitSymbol(symbol)
+	return &PaperExchange{
+		balances:   map[string]float64{quote: startingQuote},
+		base:       base,
+		quote:      quote,
+		costs:      costs,
+		latency:    200 * time.Millisecond,
+		openOrders: make(map[string]restingOrder),
+		locked:     make(map[string]float64),
+	}
 }
 
-func (bc *BinanceConnector) Connect(paperTrading bool, symbol string) error {
-	logMessage("info", "Binance Connector Initializing...")
-	bc.isPaperTrade = paperTrading
+// SetMarket adopts the exchange's asset names, moving the starting balances over
+// when they differ from the guess made from the symbol (e.g. USDT pairs on Coinbase settle in USD).
+func (pe *PaperExchange) SetMarket(m Market) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	pe.market = m
+	if m.Base != "" && m.Base != pe.base {
+		pe.balances[m.Base] += pe.balances[pe.base]
+		delete(pe.balances, pe.base)
+		pe.base = m.Base
+	}
+	if m.Quote != "" && m.Quote != pe.quote {
+		pe.balances[m.Quote] += pe.balances[pe.quote]
+		delete(pe.balances, pe.quote)
+		pe.quote = m.Quote
+	}
+}
 
-	wsURL := fmt.Sprintf("wss://stream.binance.com:9443/ws/%s@trade", strings.ToLower(symbol))
-	logMessage("info", "Connecting to Binance WebSocket: "+wsURL)
+func (pe *PaperExchange) FeesPaid() float64 {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	return pe.feesPaid
+}
 
-	ws := js.Global().Get("WebSocket").New(wsURL)
-	bc.ws = ws
+func (pe *PaperExchange) Balances() map[string]float64 {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	balances := make(map[string]float64, len(pe.balances))
+	for asset, amount := range pe.balances {
+		balances[asset] = amount
+	}
+	return balances
+}
 
-	connected := make(chan bool)
+// Execute fills an order. latestQuote is polled after the simulated latency so the
+// fill reflects where the live market moved while the order was "in flight".
+func (pe *PaperExchange) Execute(req OrderRequest, price float64, latestQuote func() (Quote, error)) (Fill, error) {
+	if req.Type != MarketOrder {
+		return Fill{}, fmt.Errorf("unsupported paper order type: %s", req.Type)
+	}
+	if req.Side != BUY && req.Side != SELL {
+		return Fill{}, fmt.Errorf("invalid order side")
+	}
+	if req.QuoteQty <= 0 && req.Quantity <= 0 {
+		return Fill{}, fmt.Errorf("order amount must be positive")
+	}
 
-	var onOpen, onMessage, onError, onClose js.Func
+	time.Sleep(pe.latency)
+	if latestQuote != nil {
+		if q, err := latestQuote(); err == nil && q.Price > 0 {
+			price = q.Price
+		}
+	}
 
-	onOpen = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-		logMessage("success", "Binance WebSocket connection established.")
-		connected <- true
-		return nil
-	})
-	ws.Set("onopen", onOpen)
+	notional := req.QuoteQty
+	if req.Quantity > 0 {
+		notional = req.Quantity * price
+	}
+	// Market orders cross the spread, so slippage always works against the trader.
+	slippage := pe.costs.Slippage.Slippage(notional)
+	if req.Side == BUY {
+		price *= 1 + slippage
+	} else {
+		price *= 1 - slippage
+	}
 
-	onMessage = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-		event := args[0]
-		data := event.Get("data").String()
-		var tradeData map[string]interface{}
-		if err := json.Unmarshal([]byte(data), &tradeData); err != nil {
-			logMessage("error", "Error parsing Binance trade data: "+err.Error())
-			return nil
-		}
-		if priceStr, ok := tradeData["p"].(string); ok {
-			if price, err := strconv.ParseFloat(priceStr, 64); err == nil {
-				bc.mu.Lock()
-				bc.lastPrice = price
-				bc.mu.Unlock()
-			}
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	qty := req.Quantity
+	if qty <= 0 {
+		qty = req.QuoteQty / price
+	}
+	if pe.market.StepSize > 0 {
+		qty = pe.market.RoundQuantity(qty)
+	}
+	notional = qty * price
+	if !req.ReduceOnly {
+		if err := pe.market.ValidateOrder(qty, price); err != nil {
+			return Fill{}, err
 		}
-		return nil
-	})
-	ws.Set("onmessage", onMessage)
+	}
 
-	onError = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-		logMessage("error", "Binance WebSocket error.")
-		return nil
-	})
-	ws.Set("onerror", onError)
+	fee := notional * pe.costs.Fees.Rate("taker", pe.volume)
+	var err error
+	if pe.leverage > 0 {
+		qty, fee, err = pe.settlePerpetual(req, qty, price, fee)
+		notional = qty * price
+	} else {
+		err = pe.settleSpot(req, qty, notional, fee)
+	}
+	if err != nil {
+		return Fill{}, err
+	}
 
-	onClose = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-		logMessage("warning", "Binance WebSocket connection closed.")
-		onOpen.Release(); onMessage.Release(); onError.Release(); this.Release()
-		return nil
-	})
-	ws.Set("onclose", onClose)
+	fill := Fill{Symbol: req.Symbol, Side: req.Side, Price: price, Quantity: qty, Fee: fee, Liquidity: "taker", Time: time.Now()}
+	pe.fills = append(pe.fills, fill)
+	pe.volume += notional
+	pe.feesPaid += fee
+	return fill, nil
+}
 
-	select {
-	case <-connected:
+func (pe *PaperExchange) settleSpot(req OrderRequest, qty, notional, fee float64) error {
+	base, quote := pe.base, pe.quote
+	if req.Side == BUY {
+		if pe.balances[quote] < notional+fee {
+			return fmt.Errorf("insufficient %s balance: have %.2f, need %.2f", quote, pe.balances[quote], notional+fee)
+		}
+		pe.balances[quote] -= notional + fee
+		pe.balances[base] += qty
 		return nil
-	case <-time.After(10 * time.Second):
-		return fmt.Errorf("Binance WebSocket connection timed out")
 	}
-}
-
-func (bc *BinanceConnector) GetPrice() (float64, error) {
-	bc.mu.Lock()
-	defer bc.mu.Unlock()
-	if bc.lastPrice == 0 {
-		return 0, fmt.Errorf("price not available yet from Binance WebSocket")
+	if pe.balances[base] < qty {
+		return fmt.Errorf("insufficient %s balance: have %.8f, need %.8f", base, pe.balances[base], qty)
 	}
-	return bc.lastPrice, nil
+	pe.balances[base] -= qty
+	pe.balances[quote] += notional - fee
+	return nil
 }
-func (bc *BinanceConnector) PlaceOrder(bs *BotState, signal Signal, price float64, symbol string) error {
-	if bc.isPaperTrade {
-		orderType := "HOLD"
-		if signal == BUY { orderType = "BUY" }
-		if signal == SELL { orderType = "SELL" }
-		logMessage("success", fmt.Sprintf("[PAPER TRADE] Placed %s order for %s at $%.2f", orderType, symbol, price))
-		return nil
-	}
 
-	if bc.apiKey == "" || bc.apiSecret == "" {
-		err := fmt.Errorf("cannot place real order: Binance API Key or Secret is missing")
-		logMessage("error", err.Error())
-		return err
+// settlePerpetual applies a fill to a linear perpetual position margined in the quote
+// asset. The quote balance is the wallet; PnL is realized into it as the position closes.
+// It returns the filled quantity and fee, which reduce-only orders cap at the open size.
+func (pe *PaperExchange) settlePerpetual(req OrderRequest, qty, price, fee float64) (float64, float64, error) {
+	quote := pe.quote
+	direction := 1.0
+	if req.Side == SELL {
+		direction = -1.0
 	}
+	reducing := pe.position != 0 && (pe.position > 0) != (direction > 0)
 
-	// Execute the trade asynchronously to avoid blocking the bot loop
-	go func() {
-		side := "BUY"
-		if signal == SELL { side = "SELL" }
-
-		// Simple risk management: trade a fixed USD amount based on risk level
-		quoteOrderQty := "20.0" // Default: Moderate
-		switch bs.config.RiskLevel {
-		case "conservative":
-			quoteOrderQty = "10.0" // e.g., $10
-		case "aggressive":
-			quoteOrderQty = "50.0" // e.g., $50
+	if req.ReduceOnly {
+		if !reducing {
+			return 0, 0, fmt.Errorf("reduce-only order would increase the position")
 		}
+		if open := math.Abs(pe.position); qty > open {
+			fee *= open / qty
+			qty = open
+		}
+		realized := qty * (price - pe.entryPrice) * -direction
+		pe.balances[quote] += realized - fee
+		pe.position += direction * qty
+		if math.Abs(pe.position) < 1e-12 {
+			pe.position, pe.entryPrice = 0, 0
+		}
+		return qty, fee, nil
+	}
+	if reducing {
+		return 0, 0, fmt.Errorf("close the open position with a reduce-only order before reversing")
+	}
 
-		timestamp := time.Now().UnixNano() / int64(time.Millisecond)
-		queryParams := fmt.Sprintf("symbol=%s&side=%s&type=MARKET&quoteOrderQty=%s&timestamp=%d", symbol, side, quoteOrderQty, timestamp)
-
-		mac := hmac.New(sha256.New, []byte(bc.apiSecret))
-		mac.Write([]byte(queryParams))
-		signature := hex.EncodeToString(mac.Sum(nil))
+	usedMargin := math.Abs(pe.position) * pe.entryPrice / pe.leverage
+	required := qty*price/pe.leverage + fee
+	if pe.balances[quote]-usedMargin < required {
+		return 0, 0, fmt.Errorf("insufficient %s margin: have %.2f available, need %.2f", quote, pe.balances[quote]-usedMargin, required)
+	}
+	pe.balances[quote] -= fee
+	newSize := pe.position + direction*qty
+	pe.entryPrice = (math.Abs(pe.position)*pe.entryPrice + qty*price) / math.Abs(newSize)
+	pe.position = newSize
+	return qty, fee, nil
+}
 
-		endpoint := "https://api.binance.com/api/v3/order"
-		url := fmt.Sprintf("%s?%s&signature=%s", endpoint, queryParams, signature)
+// EnableDerivatives switches the account to trading a linear perpetual at the given leverage.
+func (pe *PaperExchange) EnableDerivatives(leverage float64) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	if leverage < 1 {
+		leverage = 1
+	}
+	pe.leverage = leverage
+}
 
-		headers := js.Global().Get("Object").New()
-		headers.Set("X-MBX-APIKEY", bc.apiKey)
-		reqOptions := js.Global().Get("Object").New()
-		reqOptions.Set("method", "POST")
-		reqOptions.Set("headers", headers)
+func (pe *PaperExchange) Position() Position {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	return Position{Size: pe.position, EntryPrice: pe.entryPrice}
+}
 
-		logMessage("info", fmt.Sprintf("[REAL TRADE] Submitting %s market order for %s of $%s...", side, symbol, quoteOrderQty))
+// ApplyFunding settles one funding interval: longs pay shorts when the rate is positive.
+func (pe *PaperExchange) ApplyFunding(rate, markPrice float64) float64 {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	payment := -pe.position * markPrice * rate
+	pe.balances[pe.quote] += payment
+	return payment
+}
 
-		fetchPromise := js.Global().Call("fetch", url, reqOptions)
+// restingOrder is a paper limit order with the funds it took from the balance.
+type restingOrder struct {
+	Order
+	asset string
+	hold  float64
+}
 
-		fetchPromise.Call("then", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-			response := args[0]
-			response.Call("json").Call("then", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-				resultJSON, _ := js.Global().Get("JSON").Call("stringify", args[0], nil, 2).String()
-				if response.Get("ok").Bool() {
-					logMessage("success", fmt.Sprintf("Binance order successful:\n%s", resultJSON))
-				} else {
-					logMessage("error", fmt.Sprintf("Binance API Error:\n%s", resultJSON))
+func (pe *PaperExchange) PlaceMarketOrder(side Signal, quoteQty, quantity float64) (Order, error) {
+	pe.mu.Lock()
+	price := pe.markPrice
+	pe.nextOrderID++
+	id := fmt.Sprintf("paper-%d", pe.nextOrderID)
+	pe.mu.Unlock()
+	if price <= 0 {
+		return Order{}, fmt.Errorf("no market price yet for a paper market order")
+	}
+	fill, err := pe.Execute(OrderRequest{Symbol: pe.market.Symbol, Side: side, Type: MarketOrder, QuoteQty: quoteQty, Quantity: quantity}, price, nil)
+	if err != nil {
+		return Order{}, err
+	}
+	return Order{ID: id, Side: side, Price: fill.Price, Quantity: fill.Quantity, Fee: fill.Fee, Time: fill.Time}, nil
+}
+
+// PlaceLimitOrder rests a spot limit order, moving the funds it needs out of the
+// available balance until it fills or is cancelled.
+func (pe *PaperExchange) PlaceLimitOrder(side Signal, price, quantity float64) (Order, error) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	if pe.leverage > 0 {
+		return Order{}, fmt.Errorf("paper limit orders are only supported on spot markets")
+	}
+	if side != BUY && side != SELL {
+		return Order{}, fmt.Errorf("invalid order side")
+	}
+	if pe.market.TickSize > 0 {
+		price = pe.market.RoundPrice(price)
+	}
+	if pe.market.StepSize > 0 {
+		quantity = pe.market.RoundQuantity(quantity)
+	}
+	if err := pe.market.ValidateOrder(quantity, price); err != nil {
+		return Order{}, err
+	}
+	asset, amount := pe.base, quantity
+	if side == BUY {
+		// Hold the worst-case fee too; the unused part returns on fill.
+		asset, amount = pe.quote, quantity*price*(1+pe.costs.Fees.Rate("maker", pe.volume))
+	}
+	if pe.balances[asset] < amount {
+		return Order{}, fmt.Errorf("%w: %s has %.8f available, order needs %.8f", ErrInsufficientBalance, asset, pe.balances[asset], amount)
+	}
+	pe.balances[asset] -= amount
+	pe.locked[asset] += amount
+
+	pe.nextOrderID++
+	order := Order{ID: fmt.Sprintf("paper-%d", pe.nextOrderID), Side: side, Price: price, Quantity: quantity, Time: time.Now()}
+	pe.openOrders[order.ID] = restingOrder{Order: order, asset: asset, hold: amount}
+	return order, nil
+}
+
+func (pe *PaperExchange) CancelOrder(id string) error {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	order, ok := pe.openOrders[id]
+	if !ok {
+		return fmt.Errorf("unknown paper order %s", id)
+	}
+	pe.locked[order.asset] -= order.hold
+	pe.balances[order.asset] += order.hold
+	delete(pe.openOrders, id)
+	return nil
+}
+
+// MatchLimitOrders fills every resting order the market price has reached. Fills are
+// at the order's own price and pay the maker fee, as a resting order would.
+func (pe *PaperExchange) MatchLimitOrders(price float64) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	pe.markPrice = price
+	for id, resting := range pe.openOrders {
+		order := resting.Order
+		if (order.Side == BUY && price > order.Price) || (order.Side == SELL && price < order.Price) {
+			continue
+		}
+		pe.locked[resting.asset] -= resting.hold
+		notional := order.Quantity * order.Price
+		fee := notional * pe.costs.Fees.Rate("maker", pe.volume)
+		if order.Side == BUY {
+			pe.balances[pe.quote] += resting.hold - notional - fee
+			pe.balances[pe.base] += order.Quantity
+		} else {
+			pe.balances[pe.quote] += notional - fee
+		}
+		delete(pe.openOrders, id)
+
+		order.Fee = fee
+		order.Time = time.Now()
+		pe.limitFills = append(pe.limitFills, order)
+		pe.fills = append(pe.fills, Fill{Symbol: pe.market.Symbol, Side: order.Side, Price: order.Price, Quantity: order.Quantity, Fee: fee, Liquidity: "maker", Time: order.Time})
+		pe.volume += notional
+		pe.feesPaid += fee
+	}
+}
+
+func (pe *PaperExchange) PollFills() ([]Order, error) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	fills := pe.limitFills
+	pe.limitFills = nil
+	return fills, nil
+}
+
+func (pe *PaperExchange) Reserved() map[string]float64 {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	reserved := make(map[string]float64, len(pe.locked))
+	for asset, amount := range pe.locked {
+		reserved[asset] = amount
+	}
+	return reserved
+}
+
+// PaperState is a paper account as carried over to a newly loaded module. Resting orders
+// are not carried over; the funds they held are returned to the balances.
+type PaperState struct {
+	Base       string             `json:"base"`
+	Quote      string             `json:"quote"`
+	Balances   map[string]float64 `json:"balances"`
+	Volume     float64            `json:"volume"`
+	FeesPaid   float64            `json:"feesPaid"`
+	Leverage   float64            `json:"leverage,omitempty"`
+	Position   float64            `json:"position,omitempty"`
+	EntryPrice float64            `json:"entryPrice,omitempty"`
+	MarkPrice  float64            `json:"markPrice,omitempty"`
+	Fills      []Fill             `json:"fills,omitempty"`
+}
+
+func (pe *PaperExchange) State() *PaperState {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	balances := make(map[string]float64, len(pe.balances))
+	for asset, amount := range pe.balances {
+		balances[asset] = amount + pe.locked[asset]
+	}
+	return &PaperState{Base: pe.base, Quote: pe.quote, Balances: balances, Volume: pe.volume, FeesPaid: pe.feesPaid,
+		Leverage: pe.leverage, Position: pe.position, EntryPrice: pe.entryPrice, MarkPrice: pe.markPrice, Fills: append([]Fill(nil), pe.fills...)}
+}
+
+// restorePaperExchange rebuilds a paper account from its exported state.
+func restorePaperExchange(ps *PaperState, costs CostModel) *PaperExchange {
+	pe := NewPaperExchange(ps.Base+ps.Quote, 0, costs)
+	pe.base, pe.quote = ps.Base, ps.Quote
+	pe.balances = make(map[string]float64, len(ps.Balances))
+	for asset, amount := range ps.Balances {
+		pe.balances[asset] = amount
+	}
+	pe.volume, pe.feesPaid = ps.Volume, ps.FeesPaid
+	pe.leverage, pe.position, pe.entryPrice, pe.markPrice = ps.Leverage, ps.Position, ps.EntryPrice, ps.MarkPrice
+	pe.fills = append([]Fill(nil), ps.Fills...)
+	return pe
+}
+
+// PlaceOrder turns a strategy signal into a paper market order sized by the risk level.
+// On a derivatives account a signal against the open position closes it reduce-only.
+func (pe *PaperExchange) PlaceOrder(bs *BotState, signal Signal, price float64, symbol string, latestQuote func() (Quote, error)) error {
+	req := OrderRequest{Symbol: symbol, Side: signal, Type: MarketOrder, QuoteQty: orderQuoteAmount(bs.config.RiskLevel)}
+	if pe.leverage > 0 {
+		req.QuoteQty *= pe.leverage // The risk amount is the margin committed
+	}
+	pos := pe.Position()
+	if (signal == BUY && pos.Size < 0) || (signal == SELL && pos.Size > 0) {
+		req.Quantity = math.Abs(pos.Size)
+		req.ReduceOnly = true
+	}
+	fill, err := pe.Execute(req, price, latestQuote)
+	if err != nil {
+		return err
+	}
+	orderType := "BUY"
+	if signal == SELL {
+		orderType = "SELL"
+	}
+	if req.ReduceOnly {
+		orderType += " (reduce-only)"
+	}
+	logMessage("success", fmt.Sprintf("[PAPER TRADE] Filled %s %.6f %s at $%.2f (fee $%.4f)", orderType, fill.Quantity, pe.base, fill.Price, fill.Fee))
+	return nil
+}
+
+// wsFeed keeps an exchange WebSocket open. When the socket drops it reconnects with
+// exponential backoff and jitter, calling onOpen again so subscriptions are restored,
+// and it records when the last message arrived so a silent feed can be detected.
+type wsFeed struct {
+	name         string
+	url          string
+	onOpen       func(ws js.Value)
+	onMessage    func(data string)
+	pingInterval time.Duration // Optional keep-alive for exchanges that drop idle clients
+	pingMessage  string
+	ws           js.Value
+	lastMessage  time.Time
+	attempt      int
+	closed       bool
+	connected    chan bool // Start's wait for an open socket; nil once Start has returned
+	mu           sync.Mutex
+}
+
+const (
+	wsInitialBackoff = 1 * time.Second
+	wsMaxBackoff     = 60 * time.Second
+)
+
+// Start opens the first connection and waits for it. Later drops reconnect in the
+// background. If the first socket fails, a reconnect that opens within the timeout
+// still counts.
+func (f *wsFeed) Start(timeout time.Duration) error {
+	connected := make(chan bool, 1)
+	f.mu.Lock()
+	f.connected = connected
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.connected = nil
+		f.mu.Unlock()
+	}()
+	f.connect()
+	select {
+	case <-connected:
+		return nil
+	case <-time.After(timeout):
+		f.Close()
+		return fmt.Errorf("%s WebSocket connection timed out", f.name)
+	}
+}
+
+func (f *wsFeed) connect() {
+	logMessage("info", fmt.Sprintf("Connecting to %s WebSocket: %s", f.name, f.url))
+	ws := js.Global().Get("WebSocket").New(f.url)
+	f.mu.Lock()
+	f.ws = ws
+	f.mu.Unlock()
+
+	stopPing := make(chan struct{})
+	var onOpen, onMessage, onError, onClose js.Func
+	onOpen = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		logMessage("success", fmt.Sprintf("%s WebSocket connection established.", f.name))
+		if f.pingInterval > 0 {
+			go f.keepAlive(ws, stopPing)
+		}
+		f.mu.Lock()
+		f.attempt = 0
+		f.lastMessage = time.Now()
+		connected := f.connected
+		f.mu.Unlock()
+		if f.onOpen != nil {
+			f.onOpen(ws)
+		}
+		if connected != nil {
+			select {
+			case connected <- true:
+			default:
+			}
+		}
+		return nil
+	})
+	ws.Set("onopen", onOpen)
+
+	onMessage = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		f.mu.Lock()
+		f.lastMessage = time.Now()
+		f.mu.Unlock()
+		f.onMessage(args[0].Get("data").String())
+		return nil
+	})
+	ws.Set("onmessage", onMessage)
+
+	onError = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		logMessage("error", fmt.Sprintf("%s WebSocket error.", f.name))
+		return nil
+	})
+	ws.Set("onerror", onError)
+
+	onClose = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		close(stopPing)
+		onOpen.Release()
+		onMessage.Release()
+		onError.Release()
+		onClose.Release()
+		f.mu.Lock()
+		closed := f.closed
+		f.mu.Unlock()
+		if closed {
+			logMessage("info", fmt.Sprintf("%s WebSocket connection closed.", f.name))
+			return nil
+		}
+		logMessage("warning", fmt.Sprintf("%s WebSocket connection lost.", f.name))
+		go f.reconnect()
+		return nil
+	})
+	ws.Set("onclose", onClose)
+}
+
+func (f *wsFeed) keepAlive(ws js.Value, stop chan struct{}) {
+	ticker := time.NewTicker(f.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ws.Call("send", f.pingMessage)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (f *wsFeed) reconnect() {
+	f.mu.Lock()
+	backoff := wsInitialBackoff << uint(f.attempt)
+	if backoff > wsMaxBackoff || backoff <= 0 {
+		backoff = wsMaxBackoff
+	}
+	f.attempt++
+	attempt := f.attempt
+	f.mu.Unlock()
+
+	// Equal jitter, half the backoff fixed and half random, spreads reconnects out so many
+	// clients don't hit the exchange at once while still backing off.
+	delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	logMessage("info", fmt.Sprintf("Reconnecting to %s in %s (attempt %d)...", f.name, delay.Round(time.Millisecond), attempt))
+	time.Sleep(delay)
+
+	f.mu.Lock()
+	closed := f.closed
+	f.mu.Unlock()
+	if !closed {
+		f.connect()
+	}
+}
+
+// Healthy reports whether a message has arrived within maxSilence.
+func (f *wsFeed) Healthy(maxSilence time.Duration) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !f.closed && !f.lastMessage.IsZero() && time.Since(f.lastMessage) <= maxSilence
+}
+
+func (f *wsFeed) closedByUser() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+func (f *wsFeed) Close() {
+	f.mu.Lock()
+	f.closed = true
+	ws := f.ws
+	f.mu.Unlock()
+	if !ws.IsUndefined() {
+		ws.Call("close")
+	}
+}
+
+// Send writes a message on the current socket, if it is open.
+func (f *wsFeed) Send(msg string) {
+	f.mu.Lock()
+	ws := f.ws
+	f.mu.Unlock()
+	if !ws.IsUndefined() && ws.Get("readyState").Int() == 1 {
+		ws.Call("send", msg)
+	}
+}
+
+// BookLevel is one price level of an order book.
+type BookLevel struct {
+	Price float64
+	Size  float64
+}
+
+// BookTop summarizes an order book for strategies. Imbalance compares resting size
+// on each side over the top bookImbalanceLevels levels: +1 is all bids, -1 all asks.
+type BookTop struct {
+	BestBid   float64
+	BestAsk   float64
+	BidSize   float64 // Size resting at the best bid
+	AskSize   float64
+	Spread    float64
+	SpreadBps float64 // Spread relative to the mid-price, in basis points
+	Mid       float64
+	Imbalance float64
+	Time      time.Time // When the book last changed
+}
+
+const bookImbalanceLevels = 10
+
+// OrderBook is a local L2 book built from an exchange snapshot plus incremental
+// updates. It is not ready until a snapshot has been applied.
+type OrderBook struct {
+	bids    map[float64]float64
+	asks    map[float64]float64
+	ready   bool
+	updated time.Time
+	mu      sync.Mutex
+}
+
+func NewOrderBook() *OrderBook {
+	return &OrderBook{bids: make(map[float64]float64), asks: make(map[float64]float64)}
+}
+
+// Reset discards the book, e.g. after a sequence gap, until the next snapshot.
+func (ob *OrderBook) Reset() {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	ob.bids = make(map[float64]float64)
+	ob.asks = make(map[float64]float64)
+	ob.ready = false
+}
+
+func (ob *OrderBook) Snapshot(bids, asks []BookLevel) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	ob.bids = make(map[float64]float64, len(bids))
+	ob.asks = make(map[float64]float64, len(asks))
+	for _, l := range bids {
+		if l.Size > 0 {
+			ob.bids[l.Price] = l.Size
+		}
+	}
+	for _, l := range asks {
+		if l.Size > 0 {
+			ob.asks[l.Price] = l.Size
+		}
+	}
+	ob.ready = true
+	ob.updated = time.Now()
+}
+
+// Update sets the size at one level; a zero size removes the level.
+func (ob *OrderBook) Update(bid bool, price, size float64) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	side := ob.asks
+	if bid {
+		side = ob.bids
+	}
+	if size <= 0 {
+		delete(side, price)
+	} else {
+		side[price] = size
+	}
+	ob.updated = time.Now()
+}
+
+// Top summarizes the book. It reports false while the book is unsynced, empty on
+// either side, or crossed, since none of those can be trusted for trading.
+func (ob *OrderBook) Top() (BookTop, bool) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	if !ob.ready || len(ob.bids) == 0 || len(ob.asks) == 0 {
+		return BookTop{}, false
+	}
+	bidPrices := sortedPrices(ob.bids, true)
+	askPrices := sortedPrices(ob.asks, false)
+	top := BookTop{
+		BestBid: bidPrices[0],
+		BestAsk: askPrices[0],
+		BidSize: ob.bids[bidPrices[0]],
+		AskSize: ob.asks[askPrices[0]],
+		Time:    ob.updated,
+	}
+	if top.BestBid >= top.BestAsk {
+		return BookTop{}, false
+	}
+	top.Spread = top.BestAsk - top.BestBid
+	top.Mid = (top.BestAsk + top.BestBid) / 2
+	top.SpreadBps = top.Spread / top.Mid * 10000
+	var bidDepth, askDepth float64
+	for i := 0; i < bookImbalanceLevels && i < len(bidPrices); i++ {
+		bidDepth += ob.bids[bidPrices[i]]
+	}
+	for i := 0; i < bookImbalanceLevels && i < len(askPrices); i++ {
+		askDepth += ob.asks[askPrices[i]]
+	}
+	if bidDepth+askDepth > 0 {
+		top.Imbalance = (bidDepth - askDepth) / (bidDepth + askDepth)
+	}
+	return top, true
+}
+
+func sortedPrices(levels map[float64]float64, descending bool) []float64 {
+	prices := make([]float64, 0, len(levels))
+	for p := range levels {
+		prices = append(prices, p)
+	}
+	if descending {
+		sort.Sort(sort.Reverse(sort.Float64Slice(prices)))
+	} else {
+		sort.Float64s(prices)
+	}
+	return prices
+}
+
+// parseBookLevels converts exchange [price, size] string pairs into levels.
+func parseBookLevels(raw [][]string) []BookLevel {
+	levels := make([]BookLevel, 0, len(raw))
+	for _, l := range raw {
+		if len(l) < 2 {
+			continue
+		}
+		levels = append(levels, BookLevel{Price: parseFloatOrZero(l[0]), Size: parseFloatOrZero(l[1])})
+	}
+	return levels
+}
+
+type SimulationConnector struct {
+	lastPrice  float64
+	volatility float64
+	market     Market
+	withBook   bool
+	recorder   MarketRecorder
+	paper      *PaperExchange
+}
+
+func (sc *SimulationConnector) Connect(paperTrading bool, symbol string) error {
+	logMessage("info", "Simulation Connector Initialized.")
+	base, quote := splitSymbol(symbol)
+	sc.market = Market{Symbol: symbol, ExchangeSymbol: symbol, Base: base, Quote: quote, TickSize: 0.01, StepSize: 0.000001, QuoteStep: 0.01}
+	sc.lastPrice = 100.0 + rand.Float64()*50.0
+	sc.volatility = 0.02 + rand.Float64()*0.03
+	return nil
+}
+func (sc *SimulationConnector) GetQuote() (Quote, error) {
+	trend := math.Sin(float64(time.Now().Unix())/100.0) * 0.001
+	noise := (rand.Float64() - 0.5) * sc.volatility
+	change := trend + noise
+	sc.lastPrice *= (1 + change)
+	if sc.lastPrice < 10 {
+		sc.lastPrice = 10.0
+	}
+	if sc.lastPrice > 1000 {
+		sc.lastPrice = 1000.0
+	}
+	recordEvent(sc.recorder, MarketEvent{Timestamp: time.Now().UnixNano() / int64(time.Millisecond), Exchange: "simulation", Symbol: sc.market.Symbol, Type: "ticker", Price: sc.lastPrice})
+	return Quote{Price: sc.lastPrice, Time: time.Now()}, nil
+}
+func (sc *SimulationConnector) PlaceOrder(bs *BotState, signal Signal, price float64, symbol string) error {
+	// The simulated market only moves when polled, so fill at the signal price.
+	return sc.paper.PlaceOrder(bs, signal, price, symbol, nil)
+}
+func (sc *SimulationConnector) Market() Market { return sc.market }
+func (sc *SimulationConnector) FeedHealthy(maxSilence time.Duration) bool { return true }
+func (sc *SimulationConnector) GetBalances() (map[string]float64, error) {
+	return sc.paper.Balances(), nil
+}
+func (sc *SimulationConnector) Disconnect() error { flushRecorder(sc.recorder); return nil }
+
+// OrderBook synthesizes a book around the last simulated price: a spread of a few
+// basis points and random resting size, so book-driven strategies can be tried offline.
+func (sc *SimulationConnector) OrderBook() (BookTop, bool) {
+	if !sc.withBook || sc.lastPrice == 0 {
+		return BookTop{}, false
+	}
+	halfSpread := sc.lastPrice * (0.5 + rand.Float64()*2.5) / 10000
+	bidDepth := 1 + rand.Float64()*9
+	askDepth := 1 + rand.Float64()*9
+	top := BookTop{
+		BestBid:   sc.market.RoundPrice(sc.lastPrice - halfSpread),
+		BestAsk:   sc.market.RoundPrice(sc.lastPrice + halfSpread),
+		BidSize:   bidDepth / 3,
+		AskSize:   askDepth / 3,
+		Imbalance: (bidDepth - askDepth) / (bidDepth + askDepth),
+		Time:      time.Now(),
+	}
+	if top.BestAsk <= top.BestBid {
+		top.BestAsk = top.BestBid + sc.market.TickSize
+	}
+	top.Spread = top.BestAsk - top.BestBid
+	top.Mid = (top.BestAsk + top.BestBid) / 2
+	top.SpreadBps = top.Spread / top.Mid * 10000
+	return top, true
+}
+
+// CoinbaseConnector trades through the Coinbase Advanced Trade API. Requests are
+// authenticated with a short-lived ES256 JWT signed by a CDP API key.
+type CoinbaseConnector struct {
+	apiHost      string // Host for authenticated brokerage calls
+	keyName      string // "organizations/{org_id}/apiKeys/{key_id}"
+	privateKey   string // PEM-encoded EC private key
+	legacyKey    bool   // Credentials came from the retired Exchange (Pro) API
+	signer       *ecdsa.PrivateKey
+	isPaperTrade bool
+	feed         *wsFeed
+	lastQuote    Quote
+	market       Market
+	book         *OrderBook // nil unless the level2 channel is enabled
+	lastSeq      int64      // sequence_num of the last message on this connection
+	recorder     MarketRecorder
+	paper        *PaperExchange
+	mu           sync.Mutex
+}
+
+// The sandbox only mocks the authenticated brokerage endpoints, so products and the
+// WebSocket feed always come from production.
+const (
+	coinbaseAPIHost      = "api.coinbase.com"
+	coinbaseSandboxHost  = "api-sandbox.coinbase.com"
+	coinbaseRESTEndpoint = "https://" + coinbaseAPIHost
+	coinbaseWSEndpoint   = "wss://advanced-trade-ws.coinbase.com"
+)
+
+// newCoinbaseConnector maps connector params onto Advanced Trade credentials. Configs
+// saved before the migration carry apiKey/apiSecret/secretPhrase: a key name and PEM
+// key entered in those fields still work, while an old HMAC secret is flagged as retired.
+func newCoinbaseConnector(params map[string]string) *CoinbaseConnector {
+	cc := &CoinbaseConnector{apiHost: coinbaseAPIHost, keyName: params["apiKeyName"], privateKey: params["apiPrivateKey"]}
+	if cc.keyName == "" && cc.privateKey == "" {
+		cc.keyName, cc.privateKey = params["apiKey"], params["apiSecret"]
+		cc.legacyKey = params["secretPhrase"] != "" && !strings.Contains(cc.privateKey, "PRIVATE KEY")
+	}
+	// Single-line inputs can't hold the PEM's line breaks, so accept escaped "\n".
+	cc.privateKey = strings.Replace(cc.privateKey, "\\n", "\n", -1)
+	return cc
+}
+
+func (cc *CoinbaseConnector) loadSigner() error {
+	if cc.legacyKey {
+		return fmt.Errorf("Coinbase Exchange API keys (key, secret and passphrase) are retired; create a CDP API key for Advanced Trade and enter its name and private key")
+	}
+	if cc.keyName == "" || cc.privateKey == "" {
+		return fmt.Errorf("API Key Name or Private Key is missing for Coinbase")
+	}
+	block, _ := pem.Decode([]byte(cc.privateKey))
+	if block == nil {
+		return fmt.Errorf("Coinbase private key is not PEM encoded; legacy Exchange API secrets are no longer accepted")
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		cc.signer = key
+		return nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse Coinbase private key: %w", err)
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return fmt.Errorf("Coinbase private key must be an EC (ES256) key")
+	}
+	cc.signer = ecKey
+	return nil
+}
+
+// buildJWT signs a token valid for two minutes that authorizes one method and path.
+func (cc *CoinbaseConnector) buildJWT(method, path string) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := cryptorand.Read(nonce); err != nil {
+		return "", err
+	}
+	now := time.Now().Unix()
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "typ": "JWT", "kid": cc.keyName, "nonce": hex.EncodeToString(nonce)})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"sub": cc.keyName,
+		"iss": "cdp",
+		"nbf": now,
+		"exp": now + 120,
+		"uri": method + " " + cc.apiHost + path,
+	})
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, sig, err := ecdsa.Sign(cryptorand.Reader, cc.signer, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign Coinbase JWT: %w", err)
+	}
+	// JWS encodes ES256 signatures as the fixed-width concatenation r || s.
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	sig.FillBytes(signature[32:])
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// signedRequest builds fetch options carrying a bearer JWT. The token's uri claim
+// covers the path only, never the query string.
+func (cc *CoinbaseConnector) signedRequest(method, path, body string) (js.Value, error) {
+	token, err := cc.buildJWT(method, path)
+	if err != nil {
+		return js.Undefined(), err
+	}
+	headers := js.Global().Get("Object").New()
+	headers.Set("Content-Type", "application/json")
+	headers.Set("Authorization", "Bearer "+token)
+
+	reqOptions := js.Global().Get("Object").New()
+	reqOptions.Set("method", method)
+	reqOptions.Set("headers", headers)
+	if body != "" {
+		reqOptions.Set("body", body)
+	}
+	return reqOptions, nil
+}
+
+type coinbaseProduct struct {
+	ProductID       string `json:"product_id"`
+	BaseCurrencyID  string `json:"base_currency_id"`
+	QuoteCurrencyID string `json:"quote_currency_id"`
+	BaseIncrement   string `json:"base_increment"`
+	QuoteIncrement  string `json:"quote_increment"`
+	PriceIncrement  string `json:"price_increment"`
+	BaseMinSize     string `json:"base_min_size"`
+	QuoteMinSize    string `json:"quote_min_size"`
+}
+
+// loadMarket resolves the Coinbase product for a bot symbol. Coinbase quotes most
+// pairs in USD rather than USDT, so a USDT pair falls back to its USD product.
+func (cc *CoinbaseConnector) loadMarket(symbol string) error {
+	base, quote := splitSymbol(symbol)
+	candidates := []string{base + "-" + quote}
+	if quote == "USDT" {
+		candidates = append(candidates, base+"-USD")
+	}
+	for _, id := range candidates {
+		var product coinbaseProduct
+		status, err := fetchJSON(coinbaseRESTEndpoint+"/api/v3/brokerage/market/products/"+id, js.Undefined(), &product)
+		if err != nil {
+			return fmt.Errorf("failed to load Coinbase product %s: %w", id, err)
+		}
+		if status == 404 || status == 400 {
+			continue
+		}
+		if status != 200 {
+			return fmt.Errorf("failed to load Coinbase product %s: HTTP %d", id, status)
+		}
+		cc.market = Market{
+			Symbol:         strings.ToUpper(symbol),
+			ExchangeSymbol: product.ProductID,
+			Base:           product.BaseCurrencyID,
+			Quote:          product.QuoteCurrencyID,
+			TickSize:       parseFloatOrZero(product.PriceIncrement),
+			StepSize:       parseFloatOrZero(product.BaseIncrement),
+			MinQty:         parseFloatOrZero(product.BaseMinSize),
+			MinNotional:    parseFloatOrZero(product.QuoteMinSize),
+			QuoteStep:      parseFloatOrZero(product.QuoteIncrement),
+		}
+		return nil
+	}
+	return fmt.Errorf("no Coinbase product found for %s", symbol)
+}
+
+func (cc *CoinbaseConnector) Connect(paperTrading bool, symbol string) error {
+	logMessage("info", "Coinbase Connector Initializing...")
+	cc.isPaperTrade = paperTrading
+	if !paperTrading {
+		if err := cc.loadSigner(); err != nil {
+			return err
+		}
+	}
+	if err := cc.loadMarket(symbol); err != nil {
+		return err
+	}
+	logMessage("info", fmt.Sprintf("Loaded Coinbase market %s (tick %g, step %g, min funds %g)", cc.market.ExchangeSymbol, cc.market.TickSize, cc.market.StepSize, cc.market.MinNotional))
+
+	cc.feed = &wsFeed{
+		name: "Coinbase",
+		url:  coinbaseWSEndpoint,
+		onOpen: func(ws js.Value) {
+			// Advanced Trade takes one channel per subscribe message and needs it after every
+			// (re)connect. Heartbeats keep quiet markets from looking stale.
+			coinbaseSymbol := cc.market.ExchangeSymbol
+			channels := []string{"market_trades", "heartbeats"}
+			if cc.book != nil {
+				// Sequence numbers restart with each connection, and level2 opens with a snapshot.
+				cc.book.Reset()
+				cc.mu.Lock()
+				cc.lastSeq = -1
+				cc.mu.Unlock()
+				channels = append(channels, "level2")
+			}
+			for _, channel := range channels {
+				ws.Call("send", cc.subscription("subscribe", channel))
+			}
+			logMessage("info", fmt.Sprintf("Subscribed to Coinbase %s for %s", strings.Join(channels, ", "), coinbaseSymbol))
+		},
+		onMessage: cc.handleMessage,
+	}
+	return cc.feed.Start(10 * time.Second)
+}
+
+func (cc *CoinbaseConnector) subscription(action, channel string) string {
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":        action,
+		"product_ids": []string{cc.market.ExchangeSymbol},
+		"channel":     channel,
+	})
+	return string(msg)
+}
+
+func (cc *CoinbaseConnector) handleMessage(data string) {
+	var msg struct {
+		Channel     string `json:"channel"`
+		SequenceNum int64  `json:"sequence_num"`
+		Events      []struct {
+			Type   string `json:"type"`
+			Trades []struct {
+				Price string `json:"price"`
+				Size  string `json:"size"`
+				Side  string `json:"side"`
+				Time  string `json:"time"`
+			} `json:"trades"`
+			Updates []struct {
+				Side        string `json:"side"`
+				PriceLevel  string `json:"price_level"`
+				NewQuantity string `json:"new_quantity"`
+			} `json:"updates"`
+		} `json:"events"`
+	}
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		return
+	}
+	if cc.book != nil {
+		cc.checkSequence(msg.SequenceNum)
+	}
+	if msg.Channel == "l2_data" && cc.book != nil {
+		for _, event := range msg.Events {
+			if event.Type == "snapshot" {
+				var bids, asks []BookLevel
+				for _, u := range event.Updates {
+					level := BookLevel{Price: parseFloatOrZero(u.PriceLevel), Size: parseFloatOrZero(u.NewQuantity)}
+					if u.Side == "bid" {
+						bids = append(bids, level)
+					} else {
+						asks = append(asks, level)
+					}
+				}
+				cc.book.Snapshot(bids, asks)
+				continue
+			}
+			for _, u := range event.Updates {
+				cc.book.Update(u.Side == "bid", parseFloatOrZero(u.PriceLevel), parseFloatOrZero(u.NewQuantity))
+			}
+		}
+		return
+	}
+	if msg.Channel != "market_trades" {
+		return
+	}
+	for _, event := range msg.Events {
+		for _, t := range event.Trades {
+			price := parseFloatOrZero(t.Price)
+			tradeTime, err := time.Parse(time.RFC3339Nano, t.Time)
+			if price <= 0 || err != nil {
+				continue
+			}
+			cc.mu.Lock()
+			if tradeTime.After(cc.lastQuote.Time) {
+				cc.lastQuote = Quote{Price: price, Time: tradeTime}
+			}
+			cc.mu.Unlock()
+			// Snapshots replay recent trades on every (re)connect; only record live updates.
+			if event.Type == "update" {
+				recordEvent(cc.recorder, MarketEvent{Timestamp: tradeTime.UnixNano() / int64(time.Millisecond), Exchange: "coinbase", Symbol: cc.market.Symbol, Type: "trade", Price: price, Size: parseFloatOrZero(t.Size), Side: strings.ToLower(t.Side)})
+			}
+		}
+	}
+}
+
+// checkSequence watches sequence_num, which counts every message on the connection.
+// A gap means level2 updates may have been dropped, so the book is discarded and
+// level2 resubscribed to get a fresh snapshot.
+func (cc *CoinbaseConnector) checkSequence(seq int64) {
+	cc.mu.Lock()
+	gap := cc.lastSeq >= 0 && seq != cc.lastSeq+1
+	cc.lastSeq = seq
+	cc.mu.Unlock()
+	if !gap {
+		return
+	}
+	logMessage("warning", "Coinbase feed skipped messages; resyncing the order book")
+	cc.book.Reset()
+	cc.feed.Send(cc.subscription("unsubscribe", "level2"))
+	cc.feed.Send(cc.subscription("subscribe", "level2"))
+}
+
+func (cc *CoinbaseConnector) OrderBook() (BookTop, bool) {
+	if cc.book == nil {
+		return BookTop{}, false
+	}
+	return cc.book.Top()
+}
+
+func (cc *CoinbaseConnector) GetQuote() (Quote, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.lastQuote.Price == 0 {
+		return Quote{}, fmt.Errorf("price not available yet from Coinbase WebSocket")
+	}
+	return cc.lastQuote, nil
+}
+
+func (cc *CoinbaseConnector) PlaceOrder(bs *BotState, signal Signal, price float64, symbol string) error {
+	if cc.isPaperTrade {
+		return cc.paper.PlaceOrder(bs, signal, price, symbol, cc.GetQuote)
+	}
+
+	if cc.signer == nil {
+		err := fmt.Errorf("cannot place real order: Coinbase API key is not loaded")
+		logMessage("error", err.Error())
+		return err
+	}
+
+	side := "BUY"
+	if signal == SELL {
+		side = "SELL"
+	}
+
+	funds := orderQuoteAmount(bs.config.RiskLevel)
+	size := cc.market.RoundQuantity(funds / price)
+	if err := cc.market.ValidateOrder(size, price); err != nil {
+		return fmt.Errorf("%w: %v", ErrFilterFailure, err)
+	}
+
+	// Market buys are sized in the quote asset, market sells in the base asset.
+	orderConfig := map[string]string{"quote_size": cc.market.FormatQuote(funds)}
+	if side == "SELL" {
+		orderConfig = map[string]string{"base_size": cc.market.FormatQuantity(size)}
+	}
+	clientOrderID := make([]byte, 16)
+	cryptorand.Read(clientOrderID)
+	orderBody := map[string]interface{}{
+		"client_order_id":     hex.EncodeToString(clientOrderID),
+		"product_id":          cc.market.ExchangeSymbol,
+		"side":                side,
+		"order_configuration": map[string]interface{}{"market_market_ioc": orderConfig},
+	}
+	bodyBytes, _ := json.Marshal(orderBody)
+	requestPath := "/api/v3/brokerage/orders"
+	reqOptions, err := cc.signedRequest("POST", requestPath, string(bodyBytes))
+	if err != nil {
+		return err
+	}
+
+	logMessage("info", fmt.Sprintf("[REAL TRADE] Submitting Coinbase %s market order for %s...", side, cc.market.ExchangeSymbol))
+	var result struct {
+		Success         bool `json:"success"`
+		SuccessResponse struct {
+			OrderID string `json:"order_id"`
+		} `json:"success_response"`
+		ErrorResponse struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		} `json:"error_response"`
+	}
+	status, err := fetchJSON("https://"+cc.apiHost+requestPath, reqOptions, &result)
+	if err != nil {
+		return fmt.Errorf("network error during Coinbase trade execution: %w", err)
+	}
+	if status != 200 || !result.Success {
+		return fmt.Errorf("Coinbase API Error (HTTP %d): %s %s", status, result.ErrorResponse.Error, result.ErrorResponse.Message)
+	}
+	logMessage("success", fmt.Sprintf("Coinbase order successful: %s", result.SuccessResponse.OrderID))
+	return nil
+}
+
+func (cc *CoinbaseConnector) GetBalances() (map[string]float64, error) {
+	if cc.isPaperTrade {
+		return cc.paper.Balances(), nil
+	}
+	balances := make(map[string]float64)
+	cursor := ""
+	for {
+		path := "/api/v3/brokerage/accounts"
+		reqOptions, err := cc.signedRequest("GET", path, "")
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Accounts []struct {
+				Currency         string `json:"currency"`
+				AvailableBalance struct {
+					Value string `json:"value"`
+				} `json:"available_balance"`
+			} `json:"accounts"`
+			HasNext bool   `json:"has_next"`
+			Cursor  string `json:"cursor"`
+		}
+		reqURL := "https://" + cc.apiHost + path + "?limit=250"
+		if cursor != "" {
+			reqURL += "&cursor=" + url.QueryEscape(cursor)
+		}
+		status, err := fetchJSON(reqURL, reqOptions, &page)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch Coinbase accounts: %w", err)
+		}
+		if status != 200 {
+			return nil, fmt.Errorf("failed to fetch Coinbase accounts: HTTP %d", status)
+		}
+		for _, a := range page.Accounts {
+			balances[a.Currency] += parseFloatOrZero(a.AvailableBalance.Value)
+		}
+		if !page.HasNext || page.Cursor == "" {
+			return balances, nil
+		}
+		cursor = page.Cursor
+	}
+}
+
+func (cc *CoinbaseConnector) Market() Market { return cc.market }
+func (cc *CoinbaseConnector) Disconnect() error {
+	flushRecorder(cc.recorder)
+	if cc.feed != nil {
+		logMessage("info", "Closing Coinbase WebSocket connection.")
+		cc.feed.Close()
+	}
+	return nil
+}
+func (cc *CoinbaseConnector) FeedHealthy(maxSilence time.Duration) bool {
+	return cc.feed != nil && cc.feed.Healthy(maxSilence)
+}
+
+type BinanceConnector struct {
+	apiKey       string
+	apiSecret    string
+	restEndpoint string
+	wsEndpoint   string
+	recvWindow   int   // Milliseconds a signed request stays valid after its timestamp
+	timeOffset   int64 // Server time minus local time, in milliseconds
+	lastTimeSync time.Time
+	limits       binanceRateLimiter
+	isPaperTrade bool
+	feed         *wsFeed
+	lastQuote    Quote
+	market       Market
+	recorder     MarketRecorder
+	paper        *PaperExchange
+	mu           sync.Mutex
+
+	// Order book state, used only when the depth stream is enabled.
+	book         *OrderBook
+	depthFeed    *wsFeed
+	bookUpdateID int64                // Final update ID applied to the book
+	bookBuffer   []binanceDepthUpdate // Diffs received while a snapshot is loading
+	bookSyncing  bool
+	bookGen      int // Bumped on every resync so a stale snapshot load is discarded
+	bookMu       sync.Mutex
+
+	working map[string]Order // Live limit orders placed through PlaceLimitOrder, by orderId
+}
+
+const (
+	binanceRESTEndpoint       = "https://api.binance.com"
+	binanceWSEndpoint         = "wss://stream.binance.com:9443/ws"
+	binanceTestnetREST        = "https://testnet.binance.vision"
+	binanceTestnetWS          = "wss://stream.testnet.binance.vision/ws"
+	binanceDefaultRecvWindow  = 5000
+	binanceMaxRecvWindow      = 60000
+	binanceTimeResyncInterval = 30 * time.Minute
+)
+
+// BinanceAPIError is the {"code","msg"} body Binance returns for rejected requests.
+// It unwraps to one of the generic Err* values when the code has a known meaning.
+type BinanceAPIError struct {
+	HTTPStatus int
+	Code       int    `json:"code"`
+	Msg        string `json:"msg"`
+	RetryAfter time.Duration
+}
+
+func (e *BinanceAPIError) Error() string {
+	return fmt.Sprintf("Binance API error %d (HTTP %d): %s", e.Code, e.HTTPStatus, e.Msg)
+}
+
+func (e *BinanceAPIError) Unwrap() error {
+	switch {
+	case e.HTTPStatus == 429 || e.HTTPStatus == 418 || e.Code == -1003 || e.Code == -1015:
+		return ErrRateLimited
+	case e.Code == -1021:
+		return ErrTimestampOutOfSync
+	case e.Code == -1013 || strings.HasPrefix(e.Msg, "Filter failure"):
+		return ErrFilterFailure
+	case e.Code == -2010 && strings.Contains(strings.ToLower(e.Msg), "insufficient balance"):
+		return ErrInsufficientBalance
+	}
+	return nil
+}
+
+// Binance's published spot limits. Order submission is throttled a little below them
+// so the account never earns a 429, and a 418 ban never follows.
+const (
+	binanceWeightLimit      = 6000 // Request weight per minute
+	binanceOrderLimit10s    = 100  // Orders per 10 seconds
+	binanceOrderLimitDaily  = 200000
+	binanceThrottleFraction = 0.9
+)
+
+// binanceRateLimiter tracks the usage Binance reports in X-MBX-* response headers.
+type binanceRateLimiter struct {
+	usedWeight   int
+	orders10s    int
+	ordersDaily  int
+	updated      time.Time
+	blockedUntil time.Time
+	mu           sync.Mutex
+}
+
+func (rl *binanceRateLimiter) observe(status int, headers js.Value) {
+	if headers.IsUndefined() || headers.IsNull() {
+		return
+	}
+	header := func(name string) (int, bool) {
+		v := headers.Call("get", name)
+		if v.IsNull() {
+			return 0, false
+		}
+		n, err := strconv.Atoi(v.String())
+		return n, err == nil
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.updated = time.Now()
+	if n, ok := header("x-mbx-used-weight-1m"); ok {
+		rl.usedWeight = n
+	}
+	if n, ok := header("x-mbx-order-count-10s"); ok {
+		rl.orders10s = n
+	}
+	if n, ok := header("x-mbx-order-count-1d"); ok {
+		rl.ordersDaily = n
+	}
+	if status == 429 || status == 418 {
+		retry := time.Minute
+		if n, ok := header("retry-after"); ok {
+			retry = time.Duration(n) * time.Second
+		}
+		rl.blockedUntil = time.Now().Add(retry)
+	}
+}
+
+// waitForOrder blocks until one more order fits in the 10-second order window. Limits
+// that reset too slowly to wait out (request weight, the daily count, a ban) are
+// reported as ErrRateLimited so the signal is skipped instead.
+func (rl *binanceRateLimiter) waitForOrder() error {
+	rl.mu.Lock()
+	now := time.Now()
+	if now.Before(rl.blockedUntil) {
+		until := rl.blockedUntil
+		rl.mu.Unlock()
+		return fmt.Errorf("%w: Binance requests blocked until %s", ErrRateLimited, until.Format("15:04:05"))
+	}
+	if now.Truncate(time.Minute).Equal(rl.updated.Truncate(time.Minute)) && float64(rl.usedWeight) >= binanceWeightLimit*binanceThrottleFraction {
+		rl.mu.Unlock()
+		return fmt.Errorf("%w: Binance request weight %d of %d used this minute", ErrRateLimited, rl.usedWeight, binanceWeightLimit)
+	}
+	if float64(rl.ordersDaily) >= binanceOrderLimitDaily*binanceThrottleFraction && now.YearDay() == rl.updated.YearDay() {
+		rl.mu.Unlock()
+		return fmt.Errorf("%w: Binance daily order count %d of %d", ErrRateLimited, rl.ordersDaily, binanceOrderLimitDaily)
+	}
+	var wait time.Duration
+	window := rl.updated.Truncate(10 * time.Second)
+	if now.Truncate(10*time.Second).Equal(window) && float64(rl.orders10s) >= binanceOrderLimit10s*binanceThrottleFraction {
+		wait = window.Add(10 * time.Second).Sub(now)
+	}
+	rl.mu.Unlock()
+	if wait > 0 {
+		logMessage("warning", fmt.Sprintf("Binance order rate near limit; delaying order by %s", wait.Round(time.Millisecond)))
+		time.Sleep(wait)
+	}
+	return nil
+}
+
+// syncServerTime measures the offset between the local clock and Binance's, taking the
+// midpoint of the round trip as the moment the server read its clock.
+func (bc *BinanceConnector) syncServerTime() error {
+	var serverTime struct {
+		ServerTime int64 `json:"serverTime"`
+	}
+	sent := time.Now()
+	status, err := fetchJSON(bc.restEndpoint+"/api/v3/time", js.Undefined(), &serverTime)
+	if err != nil {
+		return fmt.Errorf("failed to fetch Binance server time: %w", err)
+	}
+	if status != 200 || serverTime.ServerTime == 0 {
+		return fmt.Errorf("failed to fetch Binance server time: HTTP %d", status)
+	}
+	received := time.Now()
+	midpoint := sent.Add(received.Sub(sent) / 2)
+	bc.timeOffset = serverTime.ServerTime - midpoint.UnixNano()/int64(time.Millisecond)
+	bc.lastTimeSync = received
+	if bc.timeOffset > 1000 || bc.timeOffset < -1000 {
+		logMessage("warning", fmt.Sprintf("Local clock differs from Binance by %dms; compensating", bc.timeOffset))
+	}
+	return nil
+}
+
+func (bc *BinanceConnector) ClockOffset() time.Duration {
+	return time.Duration(bc.timeOffset) * time.Millisecond
+}
+
+func (bc *BinanceConnector) ensureTimeSync() {
+	if time.Since(bc.lastTimeSync) < binanceTimeResyncInterval {
+		return
+	}
+	if err := bc.syncServerTime(); err != nil {
+		logMessage("warning", err.Error())
+	}
+}
+
+// call sends a signed request and decodes the response into out, mapping rejections to
+// *BinanceAPIError. A timestamp rejection triggers one clock resync and retry.
+func (bc *BinanceConnector) call(method, path, queryParams string, out interface{}) error {
+	bc.ensureTimeSync()
+	for attempt := 0; ; attempt++ {
+		url, reqOptions := bc.signedRequest(method, path, queryParams)
+		var raw json.RawMessage
+		status, headers, err := fetchJSONWithHeaders(url, reqOptions, &raw)
+		bc.limits.observe(status, headers)
+		if err != nil && status == 0 {
+			return err
+		}
+		if status == 200 {
+			if err != nil {
+				return err
+			}
+			if out != nil {
+				return json.Unmarshal(raw, out)
+			}
+			return nil
+		}
+		apiErr := &BinanceAPIError{HTTPStatus: status}
+		json.Unmarshal(raw, apiErr)
+		if apiErr.Msg == "" {
+			apiErr.Msg = "unexpected response"
+		}
+		if errors.Is(apiErr, ErrTimestampOutOfSync) && attempt == 0 {
+			logMessage("warning", "Binance rejected the request timestamp; resyncing server time")
+			if err := bc.syncServerTime(); err == nil {
+				continue
+			}
+		}
+		return apiErr
+	}
+}
+
+type binanceExchangeInfo struct {
+	Symbols []struct {
+		Symbol              string `json:"symbol"`
+		BaseAsset           string `json:"baseAsset"`
+		QuoteAsset          string `json:"quoteAsset"`
+		QuoteAssetPrecision int    `json:"quoteAssetPrecision"`
+		Filters             []struct {
+			FilterType  string `json:"filterType"`
+			TickSize    string `json:"tickSize"`
+			StepSize    string `json:"stepSize"`
+			MinQty      string `json:"minQty"`
+			MinNotional string `json:"minNotional"`
+		} `json:"filters"`
+	} `json:"symbols"`
+}
+
+func (bc *BinanceConnector) loadMarket(symbol string) error {
+	var info binanceExchangeInfo
+	status, err := fetchJSON(bc.restEndpoint+"/api/v3/exchangeInfo?symbol="+strings.ToUpper(symbol), js.Undefined(), &info)
+	if err != nil {
+		return fmt.Errorf("failed to load Binance exchange info: %w", err)
+	}
+	if status != 200 || len(info.Symbols) == 0 {
+		return fmt.Errorf("unknown Binance symbol %s (HTTP %d)", symbol, status)
+	}
+	si := info.Symbols[0]
+	m := Market{
+		Symbol:         si.Symbol,
+		ExchangeSymbol: si.Symbol,
+		Base:           si.BaseAsset,
+		Quote:          si.QuoteAsset,
+		QuoteStep:      math.Pow(10, -float64(si.QuoteAssetPrecision)),
+	}
+	for _, f := range si.Filters {
+		switch f.FilterType {
+		case "PRICE_FILTER":
+			m.TickSize = parseFloatOrZero(f.TickSize)
+		case "LOT_SIZE":
+			m.StepSize = parseFloatOrZero(f.StepSize)
+			m.MinQty = parseFloatOrZero(f.MinQty)
+		case "MIN_NOTIONAL", "NOTIONAL":
+			m.MinNotional = parseFloatOrZero(f.MinNotional)
+		}
+	}
+	bc.market = m
+	return nil
+}
+
+func (bc *BinanceConnector) Connect(paperTrading bool, symbol string) error {
+	logMessage("info", "Binance Connector Initializing...")
+	bc.isPaperTrade = paperTrading
+	if !paperTrading {
+		if err := bc.syncServerTime(); err != nil {
+			return err
+		}
+	}
+	if err := bc.loadMarket(symbol); err != nil {
+		return err
+	}
+	logMessage("info", fmt.Sprintf("Loaded Binance market %s (tick %g, step %g, min notional %g)", bc.market.Symbol, bc.market.TickSize, bc.market.StepSize, bc.market.MinNotional))
+
+	// The stream name encodes the subscription, so reconnecting to the same URL resubscribes.
+	bc.feed = &wsFeed{
+		name:      "Binance",
+		url:       fmt.Sprintf("%s/%s@trade", bc.wsEndpoint, strings.ToLower(symbol)),
+		onMessage: bc.handleMessage,
+	}
+	if err := bc.feed.Start(10 * time.Second); err != nil {
+		return err
+	}
+	if bc.book == nil {
+		return nil
+	}
+	bc.depthFeed = &wsFeed{
+		name:      "Binance depth",
+		url:       fmt.Sprintf("%s/%s@depth@100ms", bc.wsEndpoint, strings.ToLower(symbol)),
+		onOpen:    func(ws js.Value) { bc.resyncBook() },
+		onMessage: bc.handleDepth,
+	}
+	return bc.depthFeed.Start(10 * time.Second)
+}
+
+// binanceDepthUpdate is a diff depth stream event covering update IDs First..Final.
+type binanceDepthUpdate struct {
+	First int64      `json:"U"`
+	Final int64      `json:"u"`
+	Bids  [][]string `json:"b"`
+	Asks  [][]string `json:"a"`
+}
+
+const binanceBookMaxSilence = 30 * time.Second
+
+// resyncBook follows Binance's recipe for a local book: buffer stream diffs, load a
+// REST snapshot, then apply the buffered diffs that come after the snapshot.
+func (bc *BinanceConnector) resyncBook() {
+	bc.book.Reset()
+	bc.bookMu.Lock()
+	bc.bookSyncing = true
+	bc.bookBuffer = nil
+	bc.bookGen++
+	gen := bc.bookGen
+	bc.bookMu.Unlock()
+	go bc.loadBookSnapshot(gen)
+}
+
+func (bc *BinanceConnector) loadBookSnapshot(gen int) {
+	var snapshot struct {
+		LastUpdateID int64      `json:"lastUpdateId"`
+		Bids         [][]string `json:"bids"`
+		Asks         [][]string `json:"asks"`
+	}
+	for attempt := 0; ; attempt++ {
+		status, err := fetchJSON(fmt.Sprintf("%s/api/v3/depth?symbol=%s&limit=1000", bc.restEndpoint, bc.market.ExchangeSymbol), js.Undefined(), &snapshot)
+		if err == nil && status == 200 {
+			break
+		}
+		if err == nil {
+			err = fmt.Errorf("HTTP %d", status)
+		}
+		logMessage("warning", fmt.Sprintf("Failed to load Binance order book snapshot: %v", err))
+		time.Sleep(time.Duration(attempt+1) * 2 * time.Second)
+		bc.bookMu.Lock()
+		stale := gen != bc.bookGen
+		bc.bookMu.Unlock()
+		if stale || bc.depthFeed.closedByUser() {
+			return
+		}
+	}
+
+	bc.bookMu.Lock()
+	if gen != bc.bookGen {
+		bc.bookMu.Unlock()
+		return
+	}
+	bc.book.Snapshot(parseBookLevels(snapshot.Bids), parseBookLevels(snapshot.Asks))
+	bc.bookUpdateID = snapshot.LastUpdateID
+	synced := true
+	for _, update := range bc.bookBuffer {
+		if synced = bc.applyDepth(update); !synced {
+			break
+		}
+	}
+	bc.bookBuffer = nil
+	bc.bookSyncing = !synced
+	updateID := bc.bookUpdateID
+	bc.bookMu.Unlock()
+	if !synced {
+		// The snapshot is older than the oldest buffered diff; start over.
+		bc.resyncBook()
+		return
+	}
+	logMessage("info", fmt.Sprintf("Binance order book synced at update %d", updateID))
+}
+
+// applyDepth applies one diff and reports false on a sequence gap. Diffs the book
+// already covers are skipped. Callers hold bookMu.
+func (bc *BinanceConnector) applyDepth(update binanceDepthUpdate) bool {
+	if update.Final <= bc.bookUpdateID {
+		return true
+	}
+	if update.First > bc.bookUpdateID+1 {
+		return false
+	}
+	for _, l := range parseBookLevels(update.Bids) {
+		bc.book.Update(true, l.Price, l.Size)
+	}
+	for _, l := range parseBookLevels(update.Asks) {
+		bc.book.Update(false, l.Price, l.Size)
+	}
+	bc.bookUpdateID = update.Final
+	return true
+}
+
+func (bc *BinanceConnector) handleDepth(data string) {
+	var update binanceDepthUpdate
+	if err := json.Unmarshal([]byte(data), &update); err != nil {
+		return
+	}
+	bc.bookMu.Lock()
+	if bc.bookSyncing {
+		bc.bookBuffer = append(bc.bookBuffer, update)
+		bc.bookMu.Unlock()
+		return
+	}
+	ok := bc.applyDepth(update)
+	bc.bookMu.Unlock()
+	if !ok {
+		logMessage("warning", "Binance depth stream skipped updates; resyncing the order book")
+		bc.resyncBook()
+	}
+}
+
+func (bc *BinanceConnector) OrderBook() (BookTop, bool) {
+	if bc.book == nil || bc.depthFeed == nil || !bc.depthFeed.Healthy(binanceBookMaxSilence) {
+		return BookTop{}, false
+	}
+	return bc.book.Top()
+}
+
+func (bc *BinanceConnector) handleMessage(data string) {
+	var tradeData map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &tradeData); err != nil {
+		logMessage("error", "Error parsing Binance trade data: "+err.Error())
+		return
+	}
+	if priceStr, ok := tradeData["p"].(string); ok {
+		if price, err := strconv.ParseFloat(priceStr, 64); err == nil {
+			ev := MarketEvent{Timestamp: time.Now().UnixNano() / int64(time.Millisecond), Exchange: "binance", Symbol: bc.market.Symbol, Type: "trade", Price: price}
+			if tradeTime, ok := tradeData["T"].(float64); ok {
+				ev.Timestamp = int64(tradeTime)
+			}
+			if qtyStr, ok := tradeData["q"].(string); ok {
+				ev.Size, _ = strconv.ParseFloat(qtyStr, 64)
+			}
+			// "m" is true when the buyer is the maker, i.e. the aggressor sold.
+			if buyerIsMaker, ok := tradeData["m"].(bool); ok {
+				ev.Side = "buy"
+				if buyerIsMaker {
+					ev.Side = "sell"
+				}
+			}
+			bc.mu.Lock()
+			bc.lastQuote = Quote{Price: price, Time: time.Unix(0, ev.Timestamp*int64(time.Millisecond))}
+			bc.mu.Unlock()
+			recordEvent(bc.recorder, ev)
+		}
+	}
+}
+
+func (bc *BinanceConnector) GetQuote() (Quote, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if bc.lastQuote.Price == 0 {
+		return Quote{}, fmt.Errorf("price not available yet from Binance WebSocket")
+	}
+	return bc.lastQuote, nil
+}
+func (bc *BinanceConnector) PlaceOrder(bs *BotState, signal Signal, price float64, symbol string) error {
+	if bc.isPaperTrade {
+		return bc.paper.PlaceOrder(bs, signal, price, symbol, bc.GetQuote)
+	}
+
+	if bc.apiKey == "" || bc.apiSecret == "" {
+		err := fmt.Errorf("cannot place real order: Binance API Key or Secret is missing")
+		logMessage("error", err.Error())
+		return err
+	}
+
+	side := "BUY"
+	if signal == SELL {
+		side = "SELL"
+	}
+
+	// Simple risk management: trade a fixed USD amount based on risk level
+	quoteAmount := orderQuoteAmount(bs.config.RiskLevel)
+	if err := bc.market.ValidateOrder(bc.market.RoundQuantity(quoteAmount/price), price); err != nil {
+		return fmt.Errorf("%w: %v", ErrFilterFailure, err)
+	}
+	quoteOrderQty := bc.market.FormatQuote(quoteAmount)
+	if err := bc.limits.waitForOrder(); err != nil {
+		return err
+	}
+
+	queryParams := fmt.Sprintf("symbol=%s&side=%s&type=MARKET&quoteOrderQty=%s", bc.market.ExchangeSymbol, side, quoteOrderQty)
+	logMessage("info", fmt.Sprintf("[REAL TRADE] Submitting %s market order for %s of $%s...", side, symbol, quoteOrderQty))
+
+	var order struct {
+		OrderID             int64  `json:"orderId"`
+		Status              string `json:"status"`
+		ExecutedQty         string `json:"executedQty"`
+		CummulativeQuoteQty string `json:"cummulativeQuoteQty"`
+	}
+	if err := bc.call("POST", "/api/v3/order", queryParams, &order); err != nil {
+		return err
+	}
+	logMessage("success", fmt.Sprintf("Binance order %d %s: %s %s for %s %s", order.OrderID, order.Status, order.ExecutedQty, bc.market.Base, order.CummulativeQuoteQty, bc.market.Quote))
+	return nil
+}
+
+func (bc *BinanceConnector) PlaceMarketOrder(side Signal, quoteQty, quantity float64) (Order, error) {
+	if bc.isPaperTrade {
+		return bc.paper.PlaceMarketOrder(side, quoteQty, quantity)
+	}
+	if err := bc.limits.waitForOrder(); err != nil {
+		return Order{}, err
+	}
+	sideName := "BUY"
+	if side == SELL {
+		sideName = "SELL"
+	}
+	queryParams := fmt.Sprintf("symbol=%s&side=%s&type=MARKET&quoteOrderQty=%s", bc.market.ExchangeSymbol, sideName, bc.market.FormatQuote(quoteQty))
+	if quantity > 0 {
+		queryParams = fmt.Sprintf("symbol=%s&side=%s&type=MARKET&quantity=%s", bc.market.ExchangeSymbol, sideName, bc.market.FormatQuantity(quantity))
+	}
+	var resp struct {
+		OrderID             int64  `json:"orderId"`
+		ExecutedQty         string `json:"executedQty"`
+		CummulativeQuoteQty string `json:"cummulativeQuoteQty"`
+		Fills               []binanceCommission `json:"fills"`
+	}
+	if err := bc.call("POST", "/api/v3/order", queryParams+"&newOrderRespType=FULL", &resp); err != nil {
+		return Order{}, err
+	}
+	order := Order{ID: strconv.FormatInt(resp.OrderID, 10), Side: side, Quantity: parseFloatOrZero(resp.ExecutedQty), Time: time.Now()}
+	if order.Quantity > 0 {
+		order.Price = parseFloatOrZero(resp.CummulativeQuoteQty) / order.Quantity
+	}
+	bc.applyCommission(&order, resp.Fills)
+	logMessage("success", fmt.Sprintf("[REAL TRADE] Binance %s market order %s filled %s %s at %s", sideName, order.ID, resp.ExecutedQty, bc.market.Base, bc.market.FormatPrice(order.Price)))
+	return order, nil
+}
+
+// binanceCommission is the commission on one fill (or trade) of an order.
+type binanceCommission struct {
+	Commission      string `json:"commission"`
+	CommissionAsset string `json:"commissionAsset"`
+}
+
+// applyCommission books an order's commission in Fee, valued in the quote asset. Binance
+// takes base-asset commission out of what the account receives, so it is also netted out
+// of Quantity: the order then reports what can actually be sold again.
+func (bc *BinanceConnector) applyCommission(order *Order, fills []binanceCommission) {
+	for _, f := range fills {
+		amount := parseFloatOrZero(f.Commission)
+		switch f.CommissionAsset {
+		case bc.market.Quote:
+			order.Fee += amount
+		case bc.market.Base:
+			order.Quantity -= amount
+			order.Fee += amount * order.Price
+		default: // BNB or another discount asset
+			price, err := bc.tickerPrice(f.CommissionAsset + bc.market.Quote)
+			if err != nil {
+				logMessage("warning", fmt.Sprintf("Could not value %s commission in %s: %v", f.CommissionAsset, bc.market.Quote, err))
+				continue
+			}
+			order.Fee += amount * price
+		}
+	}
+}
+
+// tickerPrice returns the last price of a Binance symbol.
+func (bc *BinanceConnector) tickerPrice(symbol string) (float64, error) {
+	var ticker struct {
+		Price string `json:"price"`
+	}
+	status, err := fetchJSON(bc.restEndpoint+"/api/v3/ticker/price?symbol="+symbol, js.Undefined(), &ticker)
+	if err != nil {
+		return 0, err
+	}
+	if status != 200 {
+		return 0, fmt.Errorf("HTTP %d", status)
+	}
+	return parseFloatOrZero(ticker.Price), nil
+}
+
+// PlaceLimitOrder rests a GTC limit order. Paper accounts use the paper exchange instead.
+func (bc *BinanceConnector) PlaceLimitOrder(side Signal, price, quantity float64) (Order, error) {
+	if bc.isPaperTrade {
+		return bc.paper.PlaceLimitOrder(side, price, quantity)
+	}
+	price, quantity = bc.market.RoundPrice(price), bc.market.RoundQuantity(quantity)
+	if err := bc.market.ValidateOrder(quantity, price); err != nil {
+		return Order{}, fmt.Errorf("%w: %v", ErrFilterFailure, err)
+	}
+	if err := bc.limits.waitForOrder(); err != nil {
+		return Order{}, err
+	}
+	sideName := "BUY"
+	if side == SELL {
+		sideName = "SELL"
+	}
+	queryParams := fmt.Sprintf("symbol=%s&side=%s&type=LIMIT&timeInForce=GTC&quantity=%s&price=%s",
+		bc.market.ExchangeSymbol, sideName, bc.market.FormatQuantity(quantity), bc.market.FormatPrice(price))
+	var resp struct {
+		OrderID int64 `json:"orderId"`
+	}
+	if err := bc.call("POST", "/api/v3/order", queryParams, &resp); err != nil {
+		return Order{}, err
+	}
+	order := Order{ID: strconv.FormatInt(resp.OrderID, 10), Side: side, Price: price, Quantity: quantity, Time: time.Now()}
+	bc.mu.Lock()
+	if bc.working == nil {
+		bc.working = make(map[string]Order)
+	}
+	bc.working[order.ID] = order
+	bc.mu.Unlock()
+	logMessage("info", fmt.Sprintf("[REAL TRADE] Binance %s limit order %s: %s %s at %s", sideName, order.ID, bc.market.FormatQuantity(quantity), bc.market.Base, bc.market.FormatPrice(price)))
+	return order, nil
+}
+
+func (bc *BinanceConnector) CancelOrder(id string) error {
+	if bc.isPaperTrade {
+		return bc.paper.CancelOrder(id)
+	}
+	if err := bc.call("DELETE", "/api/v3/order", fmt.Sprintf("symbol=%s&orderId=%s", bc.market.ExchangeSymbol, id), nil); err != nil {
+		return err
+	}
+	bc.mu.Lock()
+	delete(bc.working, id)
+	bc.mu.Unlock()
+	return nil
+}
+
+// PollFills compares tracked orders with the exchange's open orders and looks up each
+// one that disappeared to learn whether it filled or was cancelled elsewhere. Binance
+// reports commission per trade rather than per order, so Fee is left at zero.
+func (bc *BinanceConnector) PollFills() ([]Order, error) {
+	if bc.isPaperTrade {
+		return bc.paper.PollFills()
+	}
+	bc.mu.Lock()
+	tracked := len(bc.working)
+	bc.mu.Unlock()
+	if tracked == 0 {
+		return nil, nil
+	}
+	var open []struct {
+		OrderID int64 `json:"orderId"`
+	}
+	if err := bc.call("GET", "/api/v3/openOrders", "symbol="+bc.market.ExchangeSymbol, &open); err != nil {
+		return nil, err
+	}
+	stillOpen := make(map[string]bool, len(open))
+	for _, o := range open {
+		stillOpen[strconv.FormatInt(o.OrderID, 10)] = true
+	}
+	bc.mu.Lock()
+	var gone []Order
+	for id, order := range bc.working {
+		if !stillOpen[id] {
+			gone = append(gone, order)
+		}
+	}
+	bc.mu.Unlock()
+
+	var fills []Order
+	for _, order := range gone {
+		var status struct {
+			Status              string `json:"status"`
+			ExecutedQty         string `json:"executedQty"`
+			CummulativeQuoteQty string `json:"cummulativeQuoteQty"`
+		}
+		if err := bc.call("GET", "/api/v3/order", fmt.Sprintf("symbol=%s&orderId=%s", bc.market.ExchangeSymbol, order.ID), &status); err != nil {
+			return fills, err
+		}
+		bc.mu.Lock()
+		delete(bc.working, order.ID)
+		bc.mu.Unlock()
+		if status.Status != "FILLED" {
+			logMessage("warning", fmt.Sprintf("Binance order %s closed without filling (%s)", order.ID, status.Status))
+			continue
+		}
+		if qty := parseFloatOrZero(status.ExecutedQty); qty > 0 {
+			order.Quantity = qty
+			order.Price = parseFloatOrZero(status.CummulativeQuoteQty) / qty
+		}
+		// The order status carries no commission; the order's trades do.
+		var trades []binanceCommission
+		if err := bc.call("GET", "/api/v3/myTrades", fmt.Sprintf("symbol=%s&orderId=%s", bc.market.ExchangeSymbol, order.ID), &trades); err != nil {
+			logMessage("warning", fmt.Sprintf("Could not load commission for Binance order %s: %v", order.ID, err))
+		}
+		order.Fee = 0
+		bc.applyCommission(&order, trades)
+		order.Time = time.Now()
+		fills = append(fills, order)
+	}
+	return fills, nil
+}
+
+func (bc *BinanceConnector) Reserved() map[string]float64 {
+	if bc.isPaperTrade {
+		return bc.paper.Reserved()
+	}
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	reserved := make(map[string]float64)
+	for _, order := range bc.working {
+		if order.Side == BUY {
+			reserved[bc.market.Quote] += order.Price * order.Quantity
+		} else {
+			reserved[bc.market.Base] += order.Quantity
+		}
+	}
+	return reserved
+}
+
+// signedRequest appends recvWindow, a server-aligned timestamp and an HMAC-SHA256
+// signature to the query and returns the request URL with fetch options carrying the API key.
+func (bc *BinanceConnector) signedRequest(method, path, queryParams string) (string, js.Value) {
+	timestamp := time.Now().UnixNano()/int64(time.Millisecond) + bc.timeOffset
+	if queryParams != "" {
+		queryParams += "&"
+	}
+	queryParams += fmt.Sprintf("recvWindow=%d&timestamp=%d", bc.recvWindow, timestamp)
+
+	mac := hmac.New(sha256.New, []byte(bc.apiSecret))
+	mac.Write([]byte(queryParams))
+	signature := hex.EncodeToString(mac.Sum(nil))
+	url := fmt.Sprintf("%s%s?%s&signature=%s", bc.restEndpoint, path, queryParams, signature)
+
+	headers := js.Global().Get("Object").New()
+	headers.Set("X-MBX-APIKEY", bc.apiKey)
+	reqOptions := js.Global().Get("Object").New()
+	reqOptions.Set("method", method)
+	reqOptions.Set("headers", headers)
+	return url, reqOptions
+}
+
+func (bc *BinanceConnector) GetBalances() (map[string]float64, error) {
+	if bc.isPaperTrade {
+		return bc.paper.Balances(), nil
+	}
+	if bc.apiKey == "" || bc.apiSecret == "" {
+		return nil, fmt.Errorf("Binance API Key or Secret is missing")
+	}
+	var account struct {
+		Balances []struct {
+			Asset string `json:"asset"`
+			Free  string `json:"free"`
+		} `json:"balances"`
+	}
+	if err := bc.call("GET", "/api/v3/account", "", &account); err != nil {
+		return nil, fmt.Errorf("failed to fetch Binance account: %w", err)
+	}
+	balances := make(map[string]float64, len(account.Balances))
+	for _, b := range account.Balances {
+		balances[b.Asset] = parseFloatOrZero(b.Free)
+	}
+	return balances, nil
+}
+
+func (bc *BinanceConnector) Market() Market { return bc.market }
+func (bc *BinanceConnector) Disconnect() error {
+	flushRecorder(bc.recorder)
+	if bc.feed != nil {
+		logMessage("info", "Closing Binance WebSocket connection.")
+		bc.feed.Close()
+	}
+	if bc.depthFeed != nil {
+		bc.depthFeed.Close()
+	}
+	return nil
+}
+func (bc *BinanceConnector) FeedHealthy(maxSilence time.Duration) bool {
+	return bc.feed != nil && bc.feed.Healthy(maxSilence)
+}
+
+type KrakenConnector struct {
+	apiKey       string
+	apiSecret    string
+	restEndpoint string // Overridable so the connector can run against a local stub server
+	wsEndpoint   string
+	isPaperTrade bool
+	feed         *wsFeed
+	lastQuote    Quote
+	lastNonce    int64
+	market       Market
+	recorder     MarketRecorder
+	paper        *PaperExchange
+	mu           sync.Mutex
+}
+
+const (
+	krakenRESTEndpoint = "https://api.kraken.com"
+	krakenWSEndpoint   = "wss://ws.kraken.com/v2"
+)
+
+// Kraken's REST API still uses its legacy asset codes (XBT, XDG), and older assets keep
+// an X (crypto) or Z (fiat) prefix in balances and pair metadata. Only the codes Kraken
+// actually prefixes are listed: newer four-letter assets such as ZEUS are real names.
+var krakenAssetAliases = map[string]string{
+	"XBT": "BTC", "XDG": "DOGE",
+	"XXBT": "BTC", "XXDG": "DOGE", "XETH": "ETH", "XETC": "ETC", "XLTC": "LTC", "XXRP": "XRP",
+	"XXLM": "XLM", "XXMR": "XMR", "XZEC": "ZEC", "XMLN": "MLN", "XREP": "REP",
+	"ZUSD": "USD", "ZEUR": "EUR", "ZGBP": "GBP", "ZCAD": "CAD", "ZJPY": "JPY", "ZAUD": "AUD",
+}
+
+// krakenPairCodes are the codes Kraken expects when building a pair name, e.g. XBTUSD.
+var krakenPairCodes = map[string]string{"BTC": "XBT", "DOGE": "XDG"}
+
+func krakenAssetName(code string) string {
+	if alias, ok := krakenAssetAliases[code]; ok {
+		return alias
+	}
+	return code
+}
+
+func krakenAssetCode(asset string) string {
+	if code, ok := krakenPairCodes[asset]; ok {
+		return code
+	}
+	return asset
+}
+
+// krakenResponse is the envelope every Kraken REST endpoint returns.
+type krakenResponse struct {
+	Error  []string        `json:"error"`
+	Result json.RawMessage `json:"result"`
+}
+
+func (r krakenResponse) err() error {
+	if len(r.Error) > 0 {
+		return fmt.Errorf("%s", strings.Join(r.Error, "; "))
+	}
+	return nil
+}
+
+func (kc *KrakenConnector) loadMarket(symbol string) error {
+	base, quote := splitSymbol(symbol)
+	pair := krakenAssetCode(base) + krakenAssetCode(quote)
+	var resp krakenResponse
+	status, err := fetchJSON(kc.restEndpoint+"/0/public/AssetPairs?pair="+pair, js.Undefined(), &resp)
+	if err != nil {
+		return fmt.Errorf("failed to load Kraken asset pair %s: %w", pair, err)
+	}
+	if err := resp.err(); err != nil {
+		return fmt.Errorf("unknown Kraken pair %s: %w", pair, err)
+	}
+	if status != 200 {
+		return fmt.Errorf("failed to load Kraken asset pair %s: HTTP %d", pair, status)
+	}
+	var pairs map[string]struct {
+		Altname      string `json:"altname"`
+		Base         string `json:"base"`
+		Quote        string `json:"quote"`
+		PairDecimals int    `json:"pair_decimals"`
+		LotDecimals  int    `json:"lot_decimals"`
+		CostDecimals int    `json:"cost_decimals"`
+		OrderMin     string `json:"ordermin"`
+		CostMin      string `json:"costmin"`
+		TickSize     string `json:"tick_size"`
+	}
+	if err := json.Unmarshal(resp.Result, &pairs); err != nil {
+		return fmt.Errorf("invalid Kraken asset pair response: %w", err)
+	}
+	for _, p := range pairs {
+		m := Market{
+			Symbol:         strings.ToUpper(symbol),
+			ExchangeSymbol: p.Altname,
+			Base:           krakenAssetName(p.Base),
+			Quote:          krakenAssetName(p.Quote),
+			TickSize:       parseFloatOrZero(p.TickSize),
+			StepSize:       math.Pow(10, -float64(p.LotDecimals)),
+			MinQty:         parseFloatOrZero(p.OrderMin),
+			MinNotional:    parseFloatOrZero(p.CostMin),
+			QuoteStep:      math.Pow(10, -float64(p.CostDecimals)),
+		}
+		if m.TickSize == 0 {
+			m.TickSize = math.Pow(10, -float64(p.PairDecimals))
+		}
+		kc.market = m
+		return nil
+	}
+	return fmt.Errorf("no Kraken asset pair found for %s", symbol)
+}
+
+func (kc *KrakenConnector) Connect(paperTrading bool, symbol string) error {
+	logMessage("info", "Kraken Connector Initializing...")
+	kc.isPaperTrade = paperTrading
+	if !paperTrading && (kc.apiKey == "" || kc.apiSecret == "") {
+		return fmt.Errorf("API Key or Private Key is missing for Kraken")
+	}
+	if err := kc.loadMarket(symbol); err != nil {
+		return err
+	}
+	logMessage("info", fmt.Sprintf("Loaded Kraken market %s (tick %g, step %g, min cost %g)", kc.market.ExchangeSymbol, kc.market.TickSize, kc.market.StepSize, kc.market.MinNotional))
+
+	// WebSocket v2 names pairs with standard asset codes, e.g. "BTC/USD".
+	wsSymbol := kc.market.Base + "/" + kc.market.Quote
+	kc.feed = &wsFeed{
+		name: "Kraken",
+		url:  kc.wsEndpoint,
+		onOpen: func(ws js.Value) {
+			// The trade snapshot delivers the latest trades on subscribe, so a quote is
+			// available without waiting for the next trade.
+			for _, channel := range []string{"ticker", "trade"} {
+				subMsg := map[string]interface{}{
+					"method": "subscribe",
+					"params": map[string]interface{}{"channel": channel, "symbol": []string{wsSymbol}, "snapshot": true},
 				}
-				return nil
-			}))
-			return nil
-		})).Call("catch", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-			logMessage("error", fmt.Sprintf("Network error during trade execution: %v", args[0]))
-			return nil
-		}))
-	}()
+				subMsgJSON, _ := json.Marshal(subMsg)
+				ws.Call("send", string(subMsgJSON))
+			}
+			logMessage("info", fmt.Sprintf("Subscribed to Kraken ticker and trades for %s", wsSymbol))
+		},
+		onMessage: kc.handleMessage,
+	}
+	return kc.feed.Start(10 * time.Second)
+}
+
+func (kc *KrakenConnector) handleMessage(data string) {
+	var msg struct {
+		Channel string `json:"channel"`
+		Data    []struct {
+			Symbol    string  `json:"symbol"`
+			Side      string  `json:"side"`
+			Price     float64 `json:"price"`
+			Qty       float64 `json:"qty"`
+			Last      float64 `json:"last"`
+			Timestamp string  `json:"timestamp"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		logMessage("error", "Error parsing Kraken message: "+err.Error())
+		return
+	}
+	for _, d := range msg.Data {
+		ev := MarketEvent{Timestamp: time.Now().UnixNano() / int64(time.Millisecond), Exchange: "kraken", Symbol: kc.market.Symbol}
+		switch msg.Channel {
+		case "trade":
+			ev.Type, ev.Price, ev.Size, ev.Side = "trade", d.Price, d.Qty, d.Side
+			if t, err := time.Parse(time.RFC3339Nano, d.Timestamp); err == nil {
+				ev.Timestamp = t.UnixNano() / int64(time.Millisecond)
+			}
+		case "ticker":
+			// Ticker snapshots carry no exchange time, so they are stamped on receipt. They
+			// repeat the last trade price for as long as nothing trades, so only trades
+			// update the quote: a repeated price stamped on receipt would look fresh.
+			ev.Type, ev.Price = "ticker", d.Last
+		default:
+			continue
+		}
+		if ev.Price <= 0 {
+			continue
+		}
+		if ev.Type == "trade" {
+			// The snapshot may list trades newest first; the quote only moves forward.
+			t := time.Unix(0, ev.Timestamp*int64(time.Millisecond))
+			kc.mu.Lock()
+			if !t.Before(kc.lastQuote.Time) {
+				kc.lastQuote = Quote{Price: ev.Price, Time: t}
+			}
+			kc.mu.Unlock()
+		}
+		recordEvent(kc.recorder, ev)
+	}
+}
+
+func (kc *KrakenConnector) GetQuote() (Quote, error) {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	if kc.lastQuote.Price == 0 {
+		return Quote{}, fmt.Errorf("price not available yet from Kraken WebSocket")
+	}
+	return kc.lastQuote, nil
+}
+
+// nonce returns a strictly increasing value, as Kraken rejects reused or lower nonces.
+func (kc *KrakenConnector) nonce() int64 {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	n := time.Now().UnixNano() / int64(time.Microsecond)
+	if n <= kc.lastNonce {
+		n = kc.lastNonce + 1
+	}
+	kc.lastNonce = n
+	return n
+}
+
+// signedRequest builds fetch options for a private endpoint. Kraken's API-Sign is
+// HMAC-SHA512(path + SHA256(nonce + postdata)) keyed with the base64-decoded secret.
+func (kc *KrakenConnector) signedRequest(path string, params url.Values) (js.Value, error) {
+	nonce := fmt.Sprintf("%d", kc.nonce())
+	params.Set("nonce", nonce)
+	postData := params.Encode()
 
+	secret, err := base64.StdEncoding.DecodeString(kc.apiSecret)
+	if err != nil {
+		return js.Undefined(), fmt.Errorf("failed to decode Kraken private key")
+	}
+	shaSum := sha256.Sum256([]byte(nonce + postData))
+	mac := hmac.New(sha512.New, secret)
+	mac.Write(append([]byte(path), shaSum[:]...))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	headers := js.Global().Get("Object").New()
+	headers.Set("Content-Type", "application/x-www-form-urlencoded")
+	headers.Set("API-Key", kc.apiKey)
+	headers.Set("API-Sign", signature)
+
+	reqOptions := js.Global().Get("Object").New()
+	reqOptions.Set("method", "POST")
+	reqOptions.Set("headers", headers)
+	reqOptions.Set("body", postData)
+	return reqOptions, nil
+}
+
+func (kc *KrakenConnector) privateCall(path string, params url.Values, out interface{}) error {
+	reqOptions, err := kc.signedRequest(path, params)
+	if err != nil {
+		return err
+	}
+	var resp krakenResponse
+	status, err := fetchJSON(kc.restEndpoint+path, reqOptions, &resp)
+	if err != nil {
+		return err
+	}
+	if err := resp.err(); err != nil {
+		return err
+	}
+	if status != 200 {
+		return fmt.Errorf("HTTP %d", status)
+	}
+	if out != nil {
+		return json.Unmarshal(resp.Result, out)
+	}
 	return nil
 }
-func (bc *BinanceConnector) Disconnect() error {
-	if !bc.ws.IsUndefined() {
-		logMessage("info", "Closing Binance WebSocket connection.")
-		bc.ws.Call("close")
+
+func (kc *KrakenConnector) PlaceOrder(bs *BotState, signal Signal, price float64, symbol string) error {
+	if kc.isPaperTrade {
+		return kc.paper.PlaceOrder(bs, signal, price, symbol, kc.GetQuote)
+	}
+
+	if kc.apiKey == "" || kc.apiSecret == "" {
+		err := fmt.Errorf("cannot place real order: Kraken API Key or Private Key is missing")
+		logMessage("error", err.Error())
+		return err
+	}
+
+	side := "buy"
+	if signal == SELL {
+		side = "sell"
+	}
+	// Kraken market orders are always sized in the base asset.
+	volume := kc.market.RoundQuantity(orderQuoteAmount(bs.config.RiskLevel) / price)
+	if err := kc.market.ValidateOrder(volume, price); err != nil {
+		return fmt.Errorf("%w: %v", ErrFilterFailure, err)
+	}
+	params := url.Values{}
+	params.Set("pair", kc.market.ExchangeSymbol)
+	params.Set("type", side)
+	params.Set("ordertype", "market")
+	params.Set("volume", kc.market.FormatQuantity(volume))
+
+	logMessage("info", fmt.Sprintf("[REAL TRADE] Submitting Kraken %s market order for %s %s...", side, params.Get("volume"), kc.market.ExchangeSymbol))
+	var result struct {
+		Descr struct {
+			Order string `json:"order"`
+		} `json:"descr"`
+		Txid []string `json:"txid"`
+	}
+	if err := kc.privateCall("/0/private/AddOrder", params, &result); err != nil {
+		return fmt.Errorf("Kraken API Error: %w", err)
+	}
+	logMessage("success", fmt.Sprintf("Kraken order successful: %s (txid %s)", result.Descr.Order, strings.Join(result.Txid, ", ")))
+	return nil
+}
+
+func (kc *KrakenConnector) GetBalances() (map[string]float64, error) {
+	if kc.isPaperTrade {
+		return kc.paper.Balances(), nil
+	}
+	var result map[string]string
+	if err := kc.privateCall("/0/private/Balance", url.Values{}, &result); err != nil {
+		return nil, fmt.Errorf("failed to fetch Kraken balance: %w", err)
+	}
+	balances := make(map[string]float64, len(result))
+	for code, amount := range result {
+		balances[krakenAssetName(code)] += parseFloatOrZero(amount)
+	}
+	return balances, nil
+}
+
+func (kc *KrakenConnector) Market() Market { return kc.market }
+func (kc *KrakenConnector) Disconnect() error {
+	flushRecorder(kc.recorder)
+	if kc.feed != nil {
+		logMessage("info", "Closing Kraken WebSocket connection.")
+		kc.feed.Close()
+	}
+	return nil
+}
+func (kc *KrakenConnector) FeedHealthy(maxSilence time.Duration) bool {
+	return kc.feed != nil && kc.feed.Healthy(maxSilence)
+}
+
+type BybitConnector struct {
+	apiKey         string
+	apiSecret      string
+	isPaperTrade   bool
+	leverage       float64
+	marginMode     string  // "isolated" or "cross"
+	maxFundingRate float64 // Refuse entries that would pay more than this per interval
+	feed           *wsFeed
+	lastQuote      Quote
+	fundingRate    float64
+	nextFunding    time.Time
+	position       Position
+	market         Market
+	recorder       MarketRecorder
+	paper          *PaperExchange
+	mu             sync.Mutex
+}
+
+const (
+	bybitRESTEndpoint = "https://api.bybit.com"
+	bybitWSEndpoint   = "wss://stream.bybit.com/v5/public/linear"
+	bybitRecvWindow   = "5000"
+)
+
+// bybitResponse is the envelope every Bybit v5 endpoint returns.
+type bybitResponse struct {
+	RetCode int             `json:"retCode"`
+	RetMsg  string          `json:"retMsg"`
+	Result  json.RawMessage `json:"result"`
+}
+
+func (bc *BybitConnector) loadMarket(symbol string) error {
+	var resp bybitResponse
+	status, err := fetchJSON(bybitRESTEndpoint+"/v5/market/instruments-info?category=linear&symbol="+strings.ToUpper(symbol), js.Undefined(), &resp)
+	if err != nil {
+		return fmt.Errorf("failed to load Bybit instrument: %w", err)
+	}
+	if status != 200 || resp.RetCode != 0 {
+		return fmt.Errorf("failed to load Bybit instrument %s: %s (HTTP %d)", symbol, resp.RetMsg, status)
+	}
+	var result struct {
+		List []struct {
+			Symbol      string `json:"symbol"`
+			BaseCoin    string `json:"baseCoin"`
+			QuoteCoin   string `json:"quoteCoin"`
+			PriceFilter struct {
+				TickSize string `json:"tickSize"`
+			} `json:"priceFilter"`
+			LotSizeFilter struct {
+				QtyStep          string `json:"qtyStep"`
+				MinOrderQty      string `json:"minOrderQty"`
+				MinNotionalValue string `json:"minNotionalValue"`
+			} `json:"lotSizeFilter"`
+			LeverageFilter struct {
+				MaxLeverage string `json:"maxLeverage"`
+			} `json:"leverageFilter"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(resp.Result, &result); err != nil || len(result.List) == 0 {
+		return fmt.Errorf("unknown Bybit linear perpetual %s", symbol)
+	}
+	inst := result.List[0]
+	if max := parseFloatOrZero(inst.LeverageFilter.MaxLeverage); max > 0 && bc.leverage > max {
+		return fmt.Errorf("leverage %gx exceeds the %gx maximum for %s", bc.leverage, max, inst.Symbol)
+	}
+	bc.market = Market{
+		Symbol:         inst.Symbol,
+		ExchangeSymbol: inst.Symbol,
+		Base:           inst.BaseCoin,
+		Quote:          inst.QuoteCoin,
+		TickSize:       parseFloatOrZero(inst.PriceFilter.TickSize),
+		StepSize:       parseFloatOrZero(inst.LotSizeFilter.QtyStep),
+		MinQty:         parseFloatOrZero(inst.LotSizeFilter.MinOrderQty),
+		MinNotional:    parseFloatOrZero(inst.LotSizeFilter.MinNotionalValue),
+		QuoteStep:      0.01,
+	}
+	return nil
+}
+
+func (bc *BybitConnector) Connect(paperTrading bool, symbol string) error {
+	logMessage("info", "Bybit Connector Initializing...")
+	bc.isPaperTrade = paperTrading
+	if !paperTrading && (bc.apiKey == "" || bc.apiSecret == "") {
+		return fmt.Errorf("API Key or Secret is missing for Bybit")
+	}
+	if err := bc.loadMarket(symbol); err != nil {
+		return err
+	}
+	logMessage("info", fmt.Sprintf("Loaded Bybit perpetual %s (tick %g, step %g, %gx %s margin)", bc.market.Symbol, bc.market.TickSize, bc.market.StepSize, bc.leverage, bc.marginMode))
+
+	if !paperTrading {
+		if err := bc.configureAccount(); err != nil {
+			return err
+		}
+		if _, err := bc.GetPosition(); err != nil {
+			return err
+		}
+	}
+
+	bc.feed = &wsFeed{
+		name: "Bybit",
+		url:  bybitWSEndpoint,
+		onOpen: func(ws js.Value) {
+			subMsg := map[string]interface{}{
+				"op":   "subscribe",
+				"args": []string{"publicTrade." + bc.market.Symbol, "tickers." + bc.market.Symbol},
+			}
+			subMsgJSON, _ := json.Marshal(subMsg)
+			ws.Call("send", string(subMsgJSON))
+			logMessage("info", fmt.Sprintf("Subscribed to Bybit trades and tickers for %s", bc.market.Symbol))
+		},
+		onMessage: bc.handleMessage,
+		// Bybit closes public connections that send nothing for a while.
+		pingInterval: 20 * time.Second,
+		pingMessage:  `{"op":"ping"}`,
+	}
+	return bc.feed.Start(10 * time.Second)
+}
+
+// configureAccount applies the margin mode and leverage. Bybit answers with an
+// error code when a setting is already in place, which is not a failure.
+func (bc *BybitConnector) configureAccount() error {
+	lev := strconv.FormatFloat(bc.leverage, 'f', -1, 64)
+	tradeMode := 0
+	if bc.marginMode == "isolated" {
+		tradeMode = 1
+	}
+	body := map[string]interface{}{"category": "linear", "symbol": bc.market.Symbol, "tradeMode": tradeMode, "buyLeverage": lev, "sellLeverage": lev}
+	if err := bc.privateCall("POST", "/v5/position/switch-isolated", body, nil); err != nil && !strings.Contains(err.Error(), "110026") {
+		logMessage("warning", "Could not set Bybit margin mode: "+err.Error())
+	}
+	body = map[string]interface{}{"category": "linear", "symbol": bc.market.Symbol, "buyLeverage": lev, "sellLeverage": lev}
+	if err := bc.privateCall("POST", "/v5/position/set-leverage", body, nil); err != nil && !strings.Contains(err.Error(), "110043") {
+		return fmt.Errorf("failed to set Bybit leverage: %w", err)
+	}
+	return nil
+}
+
+func (bc *BybitConnector) handleMessage(data string) {
+	var msg struct {
+		Op    string          `json:"op"`
+		Topic string          `json:"topic"`
+		Ts    int64           `json:"ts"`
+		Data  json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		logMessage("error", "Error parsing Bybit message: "+err.Error())
+		return
+	}
+	switch {
+	case strings.HasPrefix(msg.Topic, "publicTrade."):
+		var trades []struct {
+			T int64  `json:"T"`
+			S string `json:"S"`
+			V string `json:"v"`
+			P string `json:"p"`
+		}
+		if err := json.Unmarshal(msg.Data, &trades); err != nil {
+			return
+		}
+		for _, t := range trades {
+			price := parseFloatOrZero(t.P)
+			if price <= 0 {
+				continue
+			}
+			bc.mu.Lock()
+			bc.lastQuote = Quote{Price: price, Time: time.Unix(0, t.T*int64(time.Millisecond))}
+			bc.mu.Unlock()
+			recordEvent(bc.recorder, MarketEvent{Timestamp: t.T, Exchange: "bybit", Symbol: bc.market.Symbol, Type: "trade", Price: price, Size: parseFloatOrZero(t.V), Side: strings.ToLower(t.S)})
+		}
+	case strings.HasPrefix(msg.Topic, "tickers."):
+		// Ticker deltas only carry the fields that changed.
+		var ticker struct {
+			FundingRate     string `json:"fundingRate"`
+			NextFundingTime string `json:"nextFundingTime"`
+			MarkPrice       string `json:"markPrice"`
+		}
+		if err := json.Unmarshal(msg.Data, &ticker); err != nil {
+			return
+		}
+		bc.updateFunding(ticker.FundingRate, ticker.NextFundingTime, parseFloatOrZero(ticker.MarkPrice))
+	}
+}
+
+// updateFunding tracks the funding schedule. When the next settlement time moves
+// forward an interval has settled, which the paper account is charged for.
+func (bc *BybitConnector) updateFunding(rateStr, nextStr string, markPrice float64) {
+	bc.mu.Lock()
+	prevRate, prevNext := bc.fundingRate, bc.nextFunding
+	if rateStr != "" {
+		bc.fundingRate = parseFloatOrZero(rateStr)
+	}
+	if nextStr != "" {
+		if ms, err := strconv.ParseInt(nextStr, 10, 64); err == nil {
+			bc.nextFunding = time.Unix(0, ms*int64(time.Millisecond))
+		}
+	}
+	settled := !prevNext.IsZero() && bc.nextFunding.After(prevNext)
+	if markPrice <= 0 {
+		markPrice = bc.lastQuote.Price
+	}
+	bc.mu.Unlock()
+
+	if settled && bc.isPaperTrade && bc.paper != nil {
+		if payment := bc.paper.ApplyFunding(prevRate, markPrice); payment != 0 {
+			logMessage("info", fmt.Sprintf("[PAPER TRADE] Funding settled at %.4f%%: %+.4f %s", prevRate*100, payment, bc.market.Quote))
+		}
+	}
+}
+
+func (bc *BybitConnector) GetQuote() (Quote, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if bc.lastQuote.Price == 0 {
+		return Quote{}, fmt.Errorf("price not available yet from Bybit WebSocket")
+	}
+	return bc.lastQuote, nil
+}
+
+func (bc *BybitConnector) FundingRate() (float64, time.Time) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.fundingRate, bc.nextFunding
+}
+
+func (bc *BybitConnector) Leverage() float64 { return bc.leverage }
+
+// privateCall sends a signed v5 request. The signature is the hex HMAC-SHA256 of
+// timestamp + API key + recv window + payload, where payload is the query string
+// for GET requests and the JSON body otherwise.
+func (bc *BybitConnector) privateCall(method, path string, payload interface{}, out interface{}) error {
+	timestamp := fmt.Sprintf("%d", time.Now().UnixNano()/int64(time.Millisecond))
+	reqURL := bybitRESTEndpoint + path
+	var signed, body string
+	if method == "GET" {
+		if q, ok := payload.(url.Values); ok && len(q) > 0 {
+			signed = q.Encode()
+			reqURL += "?" + signed
+		}
+	} else {
+		bodyBytes, _ := json.Marshal(payload)
+		body = string(bodyBytes)
+		signed = body
+	}
+	mac := hmac.New(sha256.New, []byte(bc.apiSecret))
+	mac.Write([]byte(timestamp + bc.apiKey + bybitRecvWindow + signed))
+
+	headers := js.Global().Get("Object").New()
+	headers.Set("Content-Type", "application/json")
+	headers.Set("X-BAPI-API-KEY", bc.apiKey)
+	headers.Set("X-BAPI-TIMESTAMP", timestamp)
+	headers.Set("X-BAPI-RECV-WINDOW", bybitRecvWindow)
+	headers.Set("X-BAPI-SIGN", hex.EncodeToString(mac.Sum(nil)))
+	reqOptions := js.Global().Get("Object").New()
+	reqOptions.Set("method", method)
+	reqOptions.Set("headers", headers)
+	if body != "" {
+		reqOptions.Set("body", body)
+	}
+
+	var resp bybitResponse
+	status, err := fetchJSON(reqURL, reqOptions, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return fmt.Errorf("%s (code %d)", resp.RetMsg, resp.RetCode)
+	}
+	if status != 200 {
+		return fmt.Errorf("HTTP %d", status)
+	}
+	if out != nil {
+		return json.Unmarshal(resp.Result, out)
+	}
+	return nil
+}
+
+func (bc *BybitConnector) GetPosition() (Position, error) {
+	if bc.isPaperTrade {
+		return bc.paper.Position(), nil
+	}
+	var result struct {
+		List []struct {
+			Side     string `json:"side"`
+			Size     string `json:"size"`
+			AvgPrice string `json:"avgPrice"`
+		} `json:"list"`
+	}
+	q := url.Values{}
+	q.Set("category", "linear")
+	q.Set("symbol", bc.market.Symbol)
+	if err := bc.privateCall("GET", "/v5/position/list", q, &result); err != nil {
+		return Position{}, fmt.Errorf("failed to fetch Bybit position: %w", err)
+	}
+	var pos Position
+	for _, p := range result.List {
+		size := parseFloatOrZero(p.Size)
+		if p.Side == "Sell" {
+			size = -size
+		}
+		pos.Size += size
+		pos.EntryPrice = parseFloatOrZero(p.AvgPrice)
+	}
+	bc.mu.Lock()
+	bc.position = pos
+	bc.mu.Unlock()
+	return pos, nil
+}
+
+// PlaceOrder treats BUY and SELL as the desired direction. A signal against the
+// open position closes it with a reduce-only order; from flat it opens a new
+// position, unless funding currently runs against that side by more than the limit.
+func (bc *BybitConnector) PlaceOrder(bs *BotState, signal Signal, price float64, symbol string) error {
+	pos, err := bc.GetPosition()
+	if err != nil {
+		return err
+	}
+	closing := (signal == BUY && pos.Size < 0) || (signal == SELL && pos.Size > 0)
+	if !closing && bc.maxFundingRate > 0 {
+		rate, _ := bc.FundingRate()
+		if (signal == BUY && rate > bc.maxFundingRate) || (signal == SELL && -rate > bc.maxFundingRate) {
+			direction := "long"
+			if signal == SELL {
+				direction = "short"
+			}
+			return fmt.Errorf("funding rate %.4f%% is against a new %s position (limit %.4f%%)", rate*100, direction, bc.maxFundingRate*100)
+		}
+	}
+	if bc.isPaperTrade {
+		return bc.paper.PlaceOrder(bs, signal, price, symbol, bc.GetQuote)
+	}
+
+	qty := bc.market.RoundQuantity(orderQuoteAmount(bs.config.RiskLevel) * bc.leverage / price)
+	if closing {
+		qty = math.Abs(pos.Size)
+	} else if err := bc.market.ValidateOrder(qty, price); err != nil {
+		return err
+	}
+	side := "Buy"
+	if signal == SELL {
+		side = "Sell"
+	}
+	body := map[string]interface{}{
+		"category":   "linear",
+		"symbol":     bc.market.Symbol,
+		"side":       side,
+		"orderType":  "Market",
+		"qty":        bc.market.FormatQuantity(qty),
+		"reduceOnly": closing,
+	}
+	action := "opening"
+	if closing {
+		action = "reduce-only close"
+	}
+	logMessage("info", fmt.Sprintf("[REAL TRADE] Submitting Bybit %s market order (%s) for %s %s...", side, action, body["qty"], bc.market.Symbol))
+	var result struct {
+		OrderID string `json:"orderId"`
+	}
+	if err := bc.privateCall("POST", "/v5/order/create", body, &result); err != nil {
+		return fmt.Errorf("Bybit API Error: %w", err)
+	}
+	logMessage("success", fmt.Sprintf("Bybit order accepted: %s", result.OrderID))
+	return nil
+}
+
+func (bc *BybitConnector) GetBalances() (map[string]float64, error) {
+	if bc.isPaperTrade {
+		return bc.paper.Balances(), nil
+	}
+	var result struct {
+		List []struct {
+			Coin []struct {
+				Coin          string `json:"coin"`
+				WalletBalance string `json:"walletBalance"`
+			} `json:"coin"`
+		} `json:"list"`
+	}
+	q := url.Values{}
+	q.Set("accountType", "UNIFIED")
+	if err := bc.privateCall("GET", "/v5/account/wallet-balance", q, &result); err != nil {
+		return nil, fmt.Errorf("failed to fetch Bybit wallet balance: %w", err)
+	}
+	balances := make(map[string]float64)
+	for _, account := range result.List {
+		for _, c := range account.Coin {
+			balances[c.Coin] += parseFloatOrZero(c.WalletBalance)
+		}
+	}
+	return balances, nil
+}
+
+func (bc *BybitConnector) Market() Market { return bc.market }
+func (bc *BybitConnector) Disconnect() error {
+	flushRecorder(bc.recorder)
+	if bc.feed != nil {
+		logMessage("info", "Closing Bybit WebSocket connection.")
+		bc.feed.Close()
 	}
 	return nil
 }
+func (bc *BybitConnector) FeedHealthy(maxSilence time.Duration) bool {
+	return bc.feed != nil && bc.feed.Healthy(maxSilence)
+}
 
 func NewBotState() *BotState {
 	return &BotState{isRunning: false, stopChannel: make(chan bool), prices: []float64{}, equity: 10000.0, initialEquity: 10000.0}
 }
 
-func initializeConnector(config Config) (Connector, error) {
+// connectorEnvironments lists the non-production environments each connector can reach.
+var connectorEnvironments = map[string][]string{
+	"binance":  {EnvTestnet},
+	"coinbase": {EnvSandbox},
+}
+
+func supportsEnvironment(connector, env string) bool {
+	if env == EnvProduction {
+		return true
+	}
+	for _, e := range connectorEnvironments[connector] {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+func initializeConnector(config Config, paper *PaperExchange) (Connector, error) {
+	var recorder MarketRecorder
+	if config.RecordMarketData {
+		recorder = NewIndexedDBRecorder()
+	}
+	env := config.Environment()
+	if config.Connector != "simulation" && !supportsEnvironment(config.Connector, env) {
+		return nil, fmt.Errorf("%s does not support the %q environment", config.Connector, env)
+	}
 	switch config.Connector {
 	case "simulation":
-		return &SimulationConnector{}, nil
+		return &SimulationConnector{withBook: config.OrderBook, recorder: recorder, paper: paper}, nil
 	case "coinbase":
-		return &CoinbaseConnector{
+		cc := newCoinbaseConnector(config.ConnectorParams)
+		if env == EnvSandbox {
+			cc.apiHost = coinbaseSandboxHost
+		}
+		if config.OrderBook {
+			cc.book = NewOrderBook()
+		}
+		cc.recorder = recorder
+		cc.paper = paper
+		return cc, nil
+	case "binance":
+		bc := &BinanceConnector{
 			apiKey:       config.ConnectorParams["apiKey"],
 			apiSecret:    config.ConnectorParams["apiSecret"],
-			secretPhrase: config.ConnectorParams["secretPhrase"],
-		}, nil
-	case "binance":
-		return &BinanceConnector{apiKey: config.ConnectorParams["apiKey"], apiSecret: config.ConnectorParams["apiSecret"]}, nil
+			restEndpoint: binanceRESTEndpoint,
+			wsEndpoint:   binanceWSEndpoint,
+			recvWindow:   int(parseFloatOrZero(config.ConnectorParams["recvWindow"])),
+			recorder:     recorder,
+			paper:        paper,
+		}
+		if env == EnvTestnet {
+			bc.restEndpoint, bc.wsEndpoint = binanceTestnetREST, binanceTestnetWS
+		}
+		if config.OrderBook {
+			bc.book = NewOrderBook()
+		}
+		if bc.recvWindow <= 0 {
+			bc.recvWindow = binanceDefaultRecvWindow
+		}
+		if bc.recvWindow > binanceMaxRecvWindow {
+			bc.recvWindow = binanceMaxRecvWindow
+		}
+		return bc, nil
+	case "kraken":
+		kc := &KrakenConnector{
+			apiKey:       config.ConnectorParams["apiKey"],
+			apiSecret:    config.ConnectorParams["apiSecret"],
+			restEndpoint: config.ConnectorParams["restEndpoint"],
+			wsEndpoint:   config.ConnectorParams["wsEndpoint"],
+			recorder:     recorder,
+			paper:        paper,
+		}
+		if kc.restEndpoint == "" {
+			kc.restEndpoint = krakenRESTEndpoint
+		}
+		if kc.wsEndpoint == "" {
+			kc.wsEndpoint = krakenWSEndpoint
+		}
+		return kc, nil
+	case "bybit":
+		bc := &BybitConnector{
+			apiKey:         config.ConnectorParams["apiKey"],
+			apiSecret:      config.ConnectorParams["apiSecret"],
+			leverage:       parseFloatOrZero(config.ConnectorParams["leverage"]),
+			marginMode:     config.ConnectorParams["marginMode"],
+			maxFundingRate: parseFloatOrZero(config.ConnectorParams["maxFundingRate"]) / 100,
+			recorder:       recorder,
+			paper:          paper,
+		}
+		if bc.leverage < 1 {
+			bc.leverage = 1
+		}
+		if bc.marginMode != "isolated" {
+			bc.marginMode = "cross"
+		}
+		if paper != nil {
+			paper.EnableDerivatives(bc.leverage)
+		}
+		return bc, nil
 	default:
 		return nil, fmt.Errorf("unknown connector type: %s", config.Connector)
 	}
@@ -472,42 +3426,126 @@ func (bs *BotState) start() {
 		logMessage("error", "Tick interval must be at least 1 second.")
 		return
 	}
+	if bs.config.LiveProduction() && !bs.config.ConfirmLiveTrading {
+		logMessage("error", fmt.Sprintf("Refusing to start: live trading on %s production places real orders. Set confirmLiveTrading to proceed, or use paper trading or a test environment.", bs.config.Connector))
+		return
+	}
+	// State imported from the previous module resumes its paper account and uptime, as
+	// long as the bot still trades the same market through the same connector.
+	resume := bs.resume
+	bs.resume = nil
+	if resume != nil && (resume.Config.Symbol != bs.config.Symbol || resume.Config.Connector != bs.config.Connector || resume.Config.PaperTrading != bs.config.PaperTrading) {
+		logMessage("warning", "Imported state was for a different market or connector; starting a fresh session.")
+		resume = nil
+	}
+	// The simulation connector never touches a real account, so it always trades on paper.
+	bs.paper = nil
+	if bs.config.PaperTrading || bs.config.Connector == "simulation" {
+		if resume != nil && resume.Paper != nil {
+			bs.paper = restorePaperExchange(resume.Paper, newCostModel(bs.config))
+			bs.equity = resume.Equity
+		} else {
+			bs.paper = NewPaperExchange(bs.config.Symbol, bs.initialEquity, newCostModel(bs.config))
+			bs.equity = bs.initialEquity
+		}
+	}
 	var err error
-	bs.connector, err = initializeConnector(bs.config)
+	bs.connector, err = initializeConnector(bs.config, bs.paper)
 	if err != nil {
 		logMessage("error", "Failed to initialize connector: "+err.Error())
 		return
 	}
+	if bs.config.Connector != "simulation" {
+		logMessage("info", fmt.Sprintf("Environment: %s %s", bs.config.Connector, strings.ToUpper(bs.config.Environment())))
+	}
+	bs.managed, bs.orders = nil, nil
+	updateCostBasis(0, 0)
+	if newManaged, ok := managedStrategies[bs.config.Strategy]; ok {
+		if bs.orders = bs.orderManager(); bs.orders == nil {
+			logMessage("error", fmt.Sprintf("The %s strategy needs limit orders, which the %s connector does not support for live trading.", bs.config.Strategy, bs.config.Connector))
+			return
+		}
+		bs.managed = newManaged()
+	}
+	if _, ok := bs.connector.(OrderBookConnector); bs.config.OrderBook && !ok {
+		logMessage("warning", fmt.Sprintf("The %s connector has no order book feed; book data will be unavailable.", bs.config.Connector))
+	}
+	bs.book, bs.bookReady = BookTop{}, false
 	if err := bs.connector.Connect(bs.config.PaperTrading, bs.config.Symbol); err != nil {
 		logMessage("error", "Failed to connect: "+err.Error())
 		return
 	}
+	if bs.paper != nil {
+		bs.paper.SetMarket(bs.connector.Market())
+	}
+	bs.balances = nil
+	bs.position = Position{}
+	if err := bs.syncBalances(); err != nil {
+		logMessage("warning", "Could not load account balances: "+err.Error())
+	}
 	bs.isRunning = true
+	bs.feedStale = false
+	bs.priceStale = false
 	bs.stopChannel = make(chan bool)
 	bs.startTime = time.Now()
+	if resume != nil && !resume.StartTime.IsZero() {
+		bs.startTime = resume.StartTime
+		logMessage("info", fmt.Sprintf("Resumed from the previous module: %d prices, %d trades.", len(bs.prices), bs.tradeCount))
+	}
 	updateStatus(fmt.Sprintf("RUNNING - %s", bs.config.Symbol))
 	logMessage("success", "Bot started successfully.")
 	updatePerformanceStats(bs.tradeCount, bs.winRate(), bs.currentPrice(), bs.profitLoss())
 	ticker := time.NewTicker(time.Duration(bs.config.TickIntervalSeconds) * time.Second)
+	balanceTicker := time.NewTicker(60 * time.Second)
 	go func() {
 		for {
 			select {
+			case <-balanceTicker.C:
+				if err := bs.syncBalances(); err != nil {
+					logMessage("warning", "Balance sync failed: "+err.Error())
+				}
 			case <-ticker.C:
-				newPrice, err := bs.connector.GetPrice()
+				if !bs.checkFeedHealth() {
+					continue
+				}
+				quote, err := bs.connector.GetQuote()
 				if err != nil {
 					logMessage("error", "Failed to get price: "+err.Error())
 					continue
 				}
+				if !bs.checkQuoteAge(quote) {
+					continue
+				}
+				newPrice := quote.Price
 				bs.prices = append(bs.prices, newPrice)
 				bs.maintainDataSize(200)
+				if bs.paper != nil {
+					bs.paper.MatchLimitOrders(newPrice)
+					bs.balances = bs.paper.Balances()
+					bs.refreshPosition()
+				}
+				if bs.balances != nil {
+					bs.equity = bs.accountValue(newPrice)
+				}
+				if bc, ok := bs.connector.(OrderBookConnector); ok {
+					bs.book, bs.bookReady = bc.OrderBook()
+				}
 				updateChart(newPrice)
 				updateUptime(time.Since(bs.startTime))
 				updatePerformanceStats(bs.tradeCount, bs.winRate(), newPrice, bs.profitLoss())
-				logMessage("info", fmt.Sprintf("New price for %s: $%.2f", bs.config.Symbol, newPrice))
+				if bs.bookReady {
+					logMessage("info", fmt.Sprintf("New price for %s: $%.2f (bid %.2f / ask %.2f, spread %.1f bps, imbalance %+.2f)", bs.config.Symbol, newPrice, bs.book.BestBid, bs.book.BestAsk, bs.book.SpreadBps, bs.book.Imbalance))
+				} else {
+					logMessage("info", fmt.Sprintf("New price for %s: $%.2f", bs.config.Symbol, newPrice))
+				}
 				bs.runStrategy()
 
 				// Calculate and update indicators for the chart
 				indicators := make(map[string]float64)
+				if bs.bookReady {
+					indicators["best_bid"] = bs.book.BestBid
+					indicators["best_ask"] = bs.book.BestAsk
+				}
 				switch bs.config.Strategy {
 				case "sma_crossover":
 					p := bs.config.StrategyParams
@@ -531,6 +3569,10 @@ func (bs *BotState) start() {
 				bs.checkPriceAlerts(newPrice)
 			case <-bs.stopChannel:
 				ticker.Stop()
+				balanceTicker.Stop()
+				if bs.managed != nil {
+					bs.managed.Stop(bs, bs.orders)
+				}
 				logMessage("info", "Bot loop stopped.")
 				return
 			}
@@ -538,6 +3580,137 @@ func (bs *BotState) start() {
 	}()
 }
 
+// checkFeedHealth pauses trading while the connector's price feed is silent and
+// resumes it once data flows again. It reports whether the tick should proceed.
+func (bs *BotState) checkFeedHealth() bool {
+	timeout := time.Duration(bs.config.FeedTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	healthy := bs.connector.FeedHealthy(timeout)
+	if !healthy && !bs.feedStale {
+		logMessage("warning", fmt.Sprintf("No market data for %s. Trading paused until the feed recovers.", timeout))
+		updateStatus(fmt.Sprintf("PAUSED - %s feed stale", bs.config.Symbol))
+	}
+	if healthy && bs.feedStale {
+		logMessage("success", "Market data feed recovered. Trading resumed.")
+		updateStatus(fmt.Sprintf("RUNNING - %s", bs.config.Symbol))
+	}
+	bs.feedStale = !healthy
+	return healthy
+}
+
+// checkQuoteAge rejects quotes older than the configured maximum age so strategies
+// never act on a price from minutes ago. The condition is logged once per episode.
+func (bs *BotState) checkQuoteAge(q Quote) bool {
+	maxAge := time.Duration(bs.config.MaxPriceAgeSeconds) * time.Second
+	if maxAge <= 0 {
+		maxAge = 60 * time.Second
+	}
+	// Quotes carry exchange time, so measure their age on the exchange's clock.
+	now := time.Now()
+	if cc, ok := bs.connector.(ClockedConnector); ok {
+		now = now.Add(cc.ClockOffset())
+	}
+	age := now.Sub(q.Time)
+	fresh := age <= maxAge
+	if !fresh && !bs.priceStale {
+		logMessage("warning", fmt.Sprintf("Last %s price is %s old (max %s). Skipping strategy and orders until fresh data arrives.", bs.config.Symbol, age.Round(time.Second), maxAge))
+	}
+	if fresh && bs.priceStale {
+		logMessage("info", fmt.Sprintf("Fresh %s price received. Strategy evaluation resumed.", bs.config.Symbol))
+	}
+	bs.priceStale = !fresh
+	return fresh
+}
+
+// syncBalances refreshes the account balances from the connector. The first
+// successful sync of a live session anchors initial equity so P/L reflects the real account.
+func (bs *BotState) syncBalances() error {
+	balances, err := bs.connector.GetBalances()
+	if err != nil {
+		return err
+	}
+	first := bs.balances == nil
+	bs.balances = balances
+	bs.refreshPosition()
+	m := bs.connector.Market()
+	if first && bs.paper == nil {
+		if quote, err := bs.connector.GetQuote(); err == nil {
+			bs.initialEquity = bs.accountValue(quote.Price)
+			bs.equity = bs.initialEquity
+		}
+		logMessage("info", fmt.Sprintf("Account balances: %.8f %s, %.2f %s available.", balances[m.Base], m.Base, balances[m.Quote], m.Quote))
+	}
+	return nil
+}
+
+// refreshPosition updates the tracked position: the signed contract position for
+// derivatives connectors, or the base asset held for spot.
+func (bs *BotState) refreshPosition() {
+	pos := Position{Size: bs.balances[bs.connector.Market().Base]}
+	if dc, ok := bs.connector.(DerivativesConnector); ok {
+		var err error
+		if pos, err = dc.GetPosition(); err != nil {
+			logMessage("warning", "Position sync failed: "+err.Error())
+			return
+		}
+	}
+	if pos.Size != bs.position.Size {
+		base := bs.connector.Market().Base
+		switch {
+		case pos.Size > 0:
+			logMessage("info", fmt.Sprintf("Position: LONG %.6f %s (entry $%.2f)", pos.Size, base, pos.EntryPrice))
+		case pos.Size < 0:
+			logMessage("info", fmt.Sprintf("Position: SHORT %.6f %s (entry $%.2f)", -pos.Size, base, pos.EntryPrice))
+		default:
+			logMessage("info", "Position: FLAT")
+		}
+	}
+	bs.position = pos
+}
+
+// accountValue is the account valued in the quote asset: spot holdings of the
+// traded pair, or the derivatives wallet plus unrealized PnL of the open position.
+func (bs *BotState) accountValue(price float64) float64 {
+	m := bs.connector.Market()
+	if _, ok := bs.connector.(DerivativesConnector); ok {
+		return bs.balances[m.Quote] + bs.position.Size*(price-bs.position.EntryPrice)
+	}
+	quote, base := bs.balances[m.Quote], bs.balances[m.Base]
+	if bs.orders != nil {
+		// Balances are what is available; funds held by open orders still belong to the account.
+		reserved := bs.orders.Reserved()
+		quote += reserved[m.Quote]
+		base += reserved[m.Base]
+	}
+	return quote + base*price
+}
+
+// checkFunds refuses orders the account cannot cover, before they reach the exchange.
+func (bs *BotState) checkFunds(signal Signal, price float64) error {
+	if bs.balances == nil {
+		return nil // Balances unknown; let the exchange decide
+	}
+	m := bs.connector.Market()
+	amount := orderQuoteAmount(bs.config.RiskLevel)
+	if _, ok := bs.connector.(DerivativesConnector); ok {
+		// Closing a position frees margin; only new exposure needs collateral.
+		closing := (signal == BUY && bs.position.Size < 0) || (signal == SELL && bs.position.Size > 0)
+		if !closing && bs.balances[m.Quote] < amount {
+			return fmt.Errorf("insufficient %s margin: %.2f available, %.2f required", m.Quote, bs.balances[m.Quote], amount)
+		}
+		return nil
+	}
+	if signal == BUY && bs.balances[m.Quote] < amount {
+		return fmt.Errorf("insufficient %s: %.2f available, %.2f required", m.Quote, bs.balances[m.Quote], amount)
+	}
+	if signal == SELL && bs.balances[m.Base]*price < amount {
+		return fmt.Errorf("insufficient %s: %.8f available, %.8f required", m.Base, bs.balances[m.Base], amount/price)
+	}
+	return nil
+}
+
 func (bs *BotState) checkPriceAlerts(currentPrice float64) {
 	if bs.lastPriceAlert == 0 {
 		bs.lastPriceAlert = currentPrice
@@ -569,6 +3742,9 @@ func (bs *BotState) stop() {
 		bs.connector.Disconnect()
 	}
 	bs.stopChannel <- true
+	if bs.paper != nil {
+		logMessage("info", fmt.Sprintf("Paper session P/L: $%.2f after $%.2f in fees.", bs.profitLoss(), bs.paper.FeesPaid()))
+	}
 	updateStatus("STOPPED")
 	logMessage("error", "Bot stopped by user.")
 }
@@ -586,6 +3762,103 @@ func (bs *BotState) currentPrice() float64 {
 }
 func (bs *BotState) profitLoss() float64 { return bs.equity - bs.initialEquity }
 
+// EngineState is the bot's progress as JSON, handed from one module to the next when mods
+// are recompiled so the bot resumes with its price history, statistics and paper account.
+type EngineState struct {
+	Version        int         `json:"version"`
+	Config         Config      `json:"config"`
+	Running        bool        `json:"running"`
+	Prices         []float64   `json:"prices"`
+	TradeCount     int         `json:"tradeCount"`
+	WinCount       int         `json:"winCount"`
+	Equity         float64     `json:"equity"`
+	InitialEquity  float64     `json:"initialEquity"`
+	LastPosition   Signal      `json:"lastPosition"`
+	LastShortSMA   float64     `json:"lastShortSMA"`
+	LastLongSMA    float64     `json:"lastLongSMA"`
+	LastRSI        float64     `json:"lastRSI"`
+	LastPriceAlert float64     `json:"lastPriceAlert"`
+	StartTime      time.Time   `json:"startTime"`
+	Paper          *PaperState `json:"paper,omitempty"`   // Paper and simulation sessions only
+	Managed        string      `json:"managed,omitempty"` // Grid or DCA strategy the bot was running
+}
+
+const engineStateVersion = 1
+
+// exportState captures the bot for the next module. The state passes through the page,
+// so the connector params, which hold the API keys, are left out; resuming only needs
+// the symbol, connector and paper mode.
+func (bs *BotState) exportState() EngineState {
+	config := bs.config
+	config.ConnectorParams = nil
+	state := EngineState{Version: engineStateVersion, Config: config, Running: bs.isRunning, Prices: append([]float64{}, bs.prices...),
+		TradeCount: bs.tradeCount, WinCount: bs.winCount, Equity: bs.equity, InitialEquity: bs.initialEquity, LastPosition: bs.lastPosition,
+		LastShortSMA: bs.lastShortSMA, LastLongSMA: bs.lastLongSMA, LastRSI: bs.lastRSI, LastPriceAlert: bs.lastPriceAlert}
+	if bs.isRunning {
+		state.StartTime = bs.startTime
+	}
+	if bs.paper != nil {
+		state.Paper = bs.paper.State()
+	}
+	if bs.managed != nil {
+		state.Managed = bs.config.Strategy
+	}
+	return state
+}
+
+// importState adopts the history and statistics of an exported state right away. If the
+// exporting bot was running, its paper account and uptime are picked up by the next start;
+// otherwise the next start opens a fresh session, as restarting a stopped bot does. Grid and
+// DCA keep their orders and cost basis to themselves, which don't carry over, so a bot that
+// was running one of them always starts fresh.
+func (bs *BotState) importState(state EngineState) error {
+	if bs.isRunning {
+		return errors.New("stop the bot before importing state")
+	}
+	if state.Version != engineStateVersion {
+		return fmt.Errorf("unsupported state version %d", state.Version)
+	}
+	bs.prices = append([]float64{}, state.Prices...)
+	bs.maintainDataSize(200)
+	bs.tradeCount, bs.winCount = state.TradeCount, state.WinCount
+	bs.equity, bs.initialEquity = state.Equity, state.InitialEquity
+	bs.lastPosition = state.LastPosition
+	bs.lastShortSMA, bs.lastLongSMA, bs.lastRSI = state.LastShortSMA, state.LastLongSMA, state.LastRSI
+	bs.lastPriceAlert = state.LastPriceAlert
+	bs.resume = nil
+	if state.Running && state.Managed == "" {
+		bs.resume = &state
+	}
+	return nil
+}
+
+// switchStrategy changes the signal strategy of a running bot from the next tick on.
+// Grid and DCA work their own orders, so switching to or from them needs a restart.
+func (bs *BotState) switchStrategy(strategy string, params map[string]float64) error {
+	if !bs.isRunning {
+		return errors.New("the bot is not running")
+	}
+	if bs.managed != nil {
+		return fmt.Errorf("the %s strategy manages its own orders; stop the bot to switch strategies", bs.config.Strategy)
+	}
+	if _, ok := strategyFunctions()[strategy]; !ok {
+		if _, managed := managedStrategies[strategy]; managed {
+			return fmt.Errorf("the %s strategy manages its own orders; stop the bot to switch to it", strategy)
+		}
+		return fmt.Errorf("unknown strategy %s", strategy)
+	}
+	changed := strategy != bs.config.Strategy
+	bs.config.Strategy, bs.config.StrategyParams = strategy, params
+	// Indicator memory belongs to the previous strategy or parameters.
+	bs.lastShortSMA, bs.lastLongSMA, bs.lastRSI = 0, 0, 0
+	if changed {
+		logMessage("info", fmt.Sprintf("Switched strategy to %s.", strategy))
+	} else {
+		logMessage("info", fmt.Sprintf("Updated %s parameters.", strategy))
+	}
+	return nil
+}
+
 type Signal int
 
 const (
@@ -596,6 +3869,36 @@ const (
 
 type StrategyFunction func(bs *BotState) Signal
 
+// StrategyView is what a user mod sees of the bot on each tick: the market data and its
+// own parameters, copied out of BotState. Mods get no connector, account or config, so
+// they can only turn prices into signals.
+type StrategyView struct {
+	Symbol     string
+	Prices     []float64          // Recent prices, oldest first
+	Params     map[string]float64 // The mod's strategy parameters
+	Book       BookTop            // Latest order book summary; only meaningful while BookReady
+	BookReady  bool
+	LastSignal Signal // Last BUY or SELL the bot acted on, HOLD before the first trade
+}
+
+// ModStrategyFunction is the entry point of a user mod.
+type ModStrategyFunction func(s StrategyView) Signal
+
+func (bs *BotState) strategyView() StrategyView {
+	params := make(map[string]float64, len(bs.config.StrategyParams))
+	for k, v := range bs.config.StrategyParams {
+		params[k] = v
+	}
+	return StrategyView{
+		Symbol:     bs.config.Symbol,
+		Prices:     append([]float64(nil), bs.prices...),
+		Params:     params,
+		Book:       bs.book,
+		BookReady:  bs.bookReady,
+		LastSignal: bs.lastPosition,
+	}
+}
+
 func sma(p []float64, t int) float64 {
 	if len(p) < t {
 		return 0.0
@@ -662,11 +3965,416 @@ func bollingerBands(p []float64, t int, s float64) (float64, float64, float64) {
 func strategySMACrossover(bs *BotState) Signal { p := bs.config.StrategyParams; sp := int(p["sma_short_period"]); lp := int(p["sma_long_period"]); if len(bs.prices) < lp { return HOLD }; cs := sma(bs.prices, sp); cl := sma(bs.prices, lp); sig := HOLD; if cs > cl && bs.lastShortSMA <= bs.lastLongSMA { sig = BUY }; if cs < cl && bs.lastShortSMA >= bs.lastLongSMA { sig = SELL }; bs.lastShortSMA = cs; bs.lastLongSMA = cl; return sig }
 func strategyRsiBasic(bs *BotState) Signal { p := bs.config.StrategyParams; t := int(p["rsi_period"]); ob := p["rsi_overbought"]; os := p["rsi_oversold"]; if len(bs.prices) < t+1 { return HOLD }; cr := rsi(bs.prices, t); sig := HOLD; if cr < os && bs.lastRSI >= os { sig = BUY }; if cr > ob && bs.lastRSI <= ob { sig = SELL }; bs.lastRSI = cr; return sig }
 func strategyStochastic(bs *BotState) Signal { p := bs.config.StrategyParams; t := int(p["period"]); ob := p["overbought"]; os := p["oversold"]; if len(bs.prices) < t { return HOLD }; cs := stochastic(bs.prices, t); sig := HOLD; if cs < os { sig = BUY }; if cs > ob { sig = SELL }; return sig }
+func strategyBookImbalance(bs *BotState) Signal { p := bs.config.StrategyParams; th := p["imbalance_threshold"]; ms := p["max_spread_bps"]; if !bs.bookReady || bs.book.SpreadBps > ms { return HOLD }; if bs.book.Imbalance > th { return BUY }; if bs.book.Imbalance < -th { return SELL }; return HOLD }
 func strategyBollinger(bs *BotState) Signal { p := bs.config.StrategyParams; t := int(p["period"]); s := p["std_dev"]; if len(bs.prices) < t { return HOLD }; u, _, l := bollingerBands(bs.prices, t, s); cp := bs.prices[len(bs.prices)-1]; sig := HOLD; if cp <= l { sig = BUY }; if cp >= u { sig = SELL }; return sig }
 
+// ManagedStrategy is a strategy that works its own orders instead of returning one
+// signal per tick, such as a grid keeping a ladder of resting limit orders.
+type ManagedStrategy interface {
+	OnTick(bs *BotState, orders OrderManager, price float64) error
+	OnFill(bs *BotState, orders OrderManager, fill Order) error
+	Stop(bs *BotState, orders OrderManager) // Cancel working orders when the bot stops
+}
+
+var managedStrategies = map[string]func() ManagedStrategy{
+	"grid": func() ManagedStrategy { return &GridStrategy{} },
+	"dca":  func() ManagedStrategy { return &DCAStrategy{} },
+}
+
+// GridStrategy keeps a ladder of limit orders across a price range: buys below the
+// market and sells above it. When a buy fills, a sell is placed one level up; when a
+// sell fills, a buy is placed one level down. Each buy-then-sell round trip earns one
+// grid step, which is tracked as grid profit after fees.
+type GridStrategy struct {
+	lines   []float64      // Grid prices, ascending
+	qty     []float64      // Base quantity traded at each line
+	working map[string]int // Open order ID -> line index
+	buyLegs map[int]Order  // Filled buy waiting for its counter-sell at line index
+	profit  float64
+	trips   int
+	started bool
+	failed  bool // Setup failed; the grid stays idle until the bot is restarted
+	inRange bool
+}
+
+func (g *GridStrategy) setup(bs *BotState) error {
+	p := bs.config.StrategyParams
+	lower, upper, levels, perLevel := p["lower_price"], p["upper_price"], int(p["grid_levels"]), p["level_quote"]
+	if lower <= 0 || upper <= lower {
+		return fmt.Errorf("grid needs 0 < lower price < upper price")
+	}
+	if levels < 2 || levels > 200 {
+		return fmt.Errorf("grid needs between 2 and 200 levels")
+	}
+	if perLevel <= 0 {
+		return fmt.Errorf("grid needs a positive amount per level")
+	}
+	m := bs.connector.Market()
+	step := (upper - lower) / float64(levels-1)
+	for i := 0; i < levels; i++ {
+		line := m.RoundPrice(lower + step*float64(i))
+		g.lines = append(g.lines, line)
+		g.qty = append(g.qty, m.RoundQuantity(perLevel/line))
+	}
+	g.working = make(map[string]int)
+	g.buyLegs = make(map[int]Order)
+	return nil
+}
+
+func (g *GridStrategy) place(orders OrderManager, side Signal, line int, qty float64) {
+	order, err := orders.PlaceLimitOrder(side, g.lines[line], qty)
+	if err != nil {
+		logMessage("warning", fmt.Sprintf("Grid level %d (%.2f) not placed: %v", line, g.lines[line], err))
+		return
+	}
+	g.working[order.ID] = line
+}
+
+// OnTick lays the ladder out on the first tick, around the price at that moment. The
+// line nearest the price is left empty so the first fills are a full step away.
+// Sells need the base asset, so on a quote-only account the upper half stays empty
+// until buys fill.
+func (g *GridStrategy) OnTick(bs *BotState, orders OrderManager, price float64) error {
+	if g.failed {
+		return nil
+	}
+	if !g.started {
+		if err := g.setup(bs); err != nil {
+			// Reported once; retrying would log the same error on every tick.
+			g.failed = true
+			return fmt.Errorf("%w; the grid will stay idle until the bot is restarted", err)
+		}
+		g.started = true
+		nearest := 0
+		for i, line := range g.lines {
+			if math.Abs(line-price) < math.Abs(g.lines[nearest]-price) {
+				nearest = i
+			}
+		}
+		baseAvailable := bs.balances[bs.connector.Market().Base]
+		unfunded := 0
+		for i := range g.lines {
+			switch {
+			case i < nearest:
+				g.place(orders, BUY, i, g.qty[i])
+			case i > nearest && baseAvailable >= g.qty[i]:
+				baseAvailable -= g.qty[i]
+				g.place(orders, SELL, i, g.qty[i])
+			case i > nearest:
+				unfunded++
+			}
+		}
+		logMessage("info", fmt.Sprintf("Grid started: %d levels from %.2f to %.2f, %d orders working", len(g.lines), g.lines[0], g.lines[len(g.lines)-1], len(g.working)))
+		if unfunded > 0 {
+			logMessage("info", fmt.Sprintf("%d sell levels wait for buys to fill, since the account holds too little %s.", unfunded, bs.connector.Market().Base))
+		}
+		g.inRange = true
+	}
+	inRange := price >= g.lines[0] && price <= g.lines[len(g.lines)-1]
+	if inRange != g.inRange {
+		g.inRange = inRange
+		if inRange {
+			logMessage("info", "Price is back inside the grid range.")
+		} else {
+			logMessage("warning", fmt.Sprintf("Price %.2f left the grid range; orders stay working until it returns.", price))
+		}
+	}
+	return nil
+}
+
+func (g *GridStrategy) OnFill(bs *BotState, orders OrderManager, fill Order) error {
+	line, ok := g.working[fill.ID]
+	if !ok {
+		return nil
+	}
+	delete(g.working, fill.ID)
+	if fill.Side == BUY {
+		logMessage("signal", fmt.Sprintf("🟢 Grid buy filled at %.2f", fill.Price))
+		plotSignalOnChart("BUY", fill.Price)
+		updateLastSignal("BUY")
+		if line+1 < len(g.lines) {
+			g.buyLegs[line+1] = fill
+			g.place(orders, SELL, line+1, fill.Quantity)
+		}
+		return nil
+	}
+
+	logMessage("signal", fmt.Sprintf("🔴 Grid sell filled at %.2f", fill.Price))
+	plotSignalOnChart("SELL", fill.Price)
+	updateLastSignal("SELL")
+	if buy, ok := g.buyLegs[line]; ok {
+		delete(g.buyLegs, line)
+		tripProfit := fill.Quantity*(fill.Price-buy.Price) - buy.Fee - fill.Fee
+		g.profit += tripProfit
+		g.trips++
+		bs.tradeCount++
+		if tripProfit > 0 {
+			bs.winCount++
+		}
+		logMessage("success", fmt.Sprintf("Grid round trip %.2f → %.2f: $%.4f (grid profit $%.4f over %d trips)", buy.Price, fill.Price, tripProfit, g.profit, g.trips))
+	}
+	if line > 0 {
+		g.place(orders, BUY, line-1, g.qty[line-1])
+	}
+	return nil
+}
+
+func (g *GridStrategy) Stop(bs *BotState, orders OrderManager) {
+	for id := range g.working {
+		if err := orders.CancelOrder(id); err != nil {
+			logMessage("warning", fmt.Sprintf("Failed to cancel grid order %s: %v", id, err))
+			continue
+		}
+		delete(g.working, id)
+	}
+	if g.started {
+		logMessage("info", fmt.Sprintf("Grid stopped: $%.4f grid profit over %d round trips.", g.profit, g.trips))
+	}
+}
+
+// DCAStrategy buys a fixed quote amount on a schedule, averaging into a position.
+// Optional safety orders add size as the price falls below the cycle's first buy, and
+// an optional take-profit sells the whole position once the price clears the average
+// cost by the configured margin, which closes the cycle and starts a new one.
+type DCAStrategy struct {
+	amount       float64       // Quote spent per scheduled buy
+	interval     time.Duration // Time between scheduled buys
+	offset       time.Duration // Shift of the schedule from the anchor, e.g. 9h for 09:00 UTC
+	nextBuy      time.Time
+	started      bool
+	failed       bool           // Setup failed; DCA stays idle until the bot is restarted
+	retryTP      time.Time      // Earliest take-profit attempt after one that failed
+	firstPrice   float64        // Price of the cycle's first buy; safety orders are spaced from it
+	quantity     float64        // Base bought this cycle
+	cost         float64        // Quote spent this cycle, fees included
+	safetyOrders map[string]int // Open safety order ID -> step
+	realized     float64
+	cycles       int
+}
+
+// dcaAnchor is the Monday schedules count from, so a 168h interval runs on Mondays
+// and a 24h interval with a 9h offset runs daily at 09:00 UTC.
+var dcaAnchor = time.Date(1970, 1, 5, 0, 0, 0, 0, time.UTC)
+
+// nextScheduledRun returns the first schedule slot strictly after t.
+func nextScheduledRun(t time.Time, interval, offset time.Duration) time.Time {
+	anchor := dcaAnchor.Add(offset)
+	return anchor.Add((t.Sub(anchor)/interval + 1) * interval)
+}
+
+func (d *DCAStrategy) setup(bs *BotState) error {
+	p := bs.config.StrategyParams
+	d.amount = p["dca_amount"]
+	d.interval = time.Duration(p["interval_hours"] * float64(time.Hour))
+	d.offset = time.Duration(p["start_hour_utc"] * float64(time.Hour))
+	if d.amount <= 0 {
+		return fmt.Errorf("DCA needs a positive amount per buy")
+	}
+	if d.interval < time.Minute {
+		return fmt.Errorf("DCA interval must be at least one minute")
+	}
+	if p["safety_orders"] > 0 && (p["safety_step_pct"] <= 0 || p["safety_step_pct"]*p["safety_orders"] >= 100) {
+		return fmt.Errorf("DCA safety orders need a step between 0%% and 100%% divided by their count")
+	}
+	d.nextBuy = nextScheduledRun(time.Now(), d.interval, d.offset)
+	if p["buy_on_start"] > 0 {
+		d.nextBuy = time.Now()
+	}
+	d.safetyOrders = make(map[string]int)
+	logMessage("info", fmt.Sprintf("DCA started: %.2f %s every %s, next buy at %s", d.amount, bs.connector.Market().Quote, d.interval, d.nextBuy.UTC().Format("2006-01-02 15:04 MST")))
+	return nil
+}
+
+func (d *DCAStrategy) addFill(bs *BotState, fill Order) {
+	d.quantity += fill.Quantity
+	d.cost += fill.Price*fill.Quantity + fill.Fee
+	updateCostBasis(d.averageCost(), d.quantity)
+}
+
+func (d *DCAStrategy) averageCost() float64 {
+	if d.quantity == 0 {
+		return 0
+	}
+	return d.cost / d.quantity
+}
+
+// placeSafetyOrders ladders limit buys below the cycle's first fill. Step k sits
+// k*safety_step_pct below it and spends dca_amount*safety_scale^(k-1).
+func (d *DCAStrategy) placeSafetyOrders(bs *BotState, orders OrderManager) {
+	p := bs.config.StrategyParams
+	scale := p["safety_scale"]
+	if scale <= 0 {
+		scale = 1
+	}
+	size := d.amount
+	for k := 1; k <= int(p["safety_orders"]); k++ {
+		price := d.firstPrice * (1 - p["safety_step_pct"]*float64(k)/100)
+		order, err := orders.PlaceLimitOrder(BUY, price, size/price)
+		if err != nil {
+			logMessage("warning", fmt.Sprintf("DCA safety order %d at %.2f not placed: %v", k, price, err))
+			break
+		}
+		d.safetyOrders[order.ID] = k
+		size *= scale
+	}
+}
+
+func (d *DCAStrategy) cancelSafetyOrders(orders OrderManager) {
+	for id := range d.safetyOrders {
+		if err := orders.CancelOrder(id); err != nil {
+			logMessage("warning", fmt.Sprintf("Failed to cancel DCA safety order %s: %v", id, err))
+		}
+		delete(d.safetyOrders, id)
+	}
+}
+
+func (d *DCAStrategy) OnTick(bs *BotState, orders OrderManager, price float64) error {
+	if d.failed {
+		return nil
+	}
+	if !d.started {
+		if err := d.setup(bs); err != nil {
+			// Reported once; retrying would log the same error on every tick.
+			d.failed = true
+			return fmt.Errorf("%w; DCA will stay idle until the bot is restarted", err)
+		}
+		d.started = true
+	}
+
+	if tp := bs.config.StrategyParams["take_profit_pct"]; tp > 0 && d.quantity > 0 && price >= d.averageCost()*(1+tp/100) && !time.Now().Before(d.retryTP) {
+		d.takeProfit(bs, orders)
+	}
+
+	now := time.Now()
+	if now.Before(d.nextBuy) {
+		return nil
+	}
+	// A missed or failed buy is skipped rather than retried every tick.
+	d.nextBuy = nextScheduledRun(now, d.interval, d.offset)
+	fill, err := orders.PlaceMarketOrder(BUY, d.amount, 0)
+	if err != nil {
+		return fmt.Errorf("scheduled DCA buy failed: %w", err)
+	}
+	d.addFill(bs, fill)
+	logMessage("signal", fmt.Sprintf("🟢 DCA buy: %.6f at %.2f (average cost %.2f), next at %s", fill.Quantity, fill.Price, d.averageCost(), d.nextBuy.UTC().Format("2006-01-02 15:04 MST")))
+	plotSignalOnChart("BUY", fill.Price)
+	updateLastSignal("BUY")
+	if d.firstPrice == 0 {
+		d.firstPrice = fill.Price
+		d.placeSafetyOrders(bs, orders)
+	}
+	return nil
+}
+
+// dcaRetryDelay is how long a failed take-profit waits before it is tried again.
+const dcaRetryDelay = time.Minute
+
+func (d *DCAStrategy) takeProfit(bs *BotState, orders OrderManager) {
+	// The sell never exceeds what the account holds, in case fees took some of it.
+	qty := d.quantity
+	m := bs.connector.Market()
+	if balances, err := bs.connector.GetBalances(); err == nil {
+		if available := balances[m.Base]; available < qty {
+			qty = m.RoundQuantity(available)
+		}
+	}
+	if qty <= 0 {
+		d.retryTP = time.Now().Add(dcaRetryDelay)
+		logMessage("warning", fmt.Sprintf("DCA take-profit skipped: no %s left in the account to sell", m.Base))
+		return
+	}
+	// The safety orders come off before the sell so none fills into a closed cycle, and
+	// go back on if the sell fails, as the cycle is still open.
+	d.cancelSafetyOrders(orders)
+	fill, err := orders.PlaceMarketOrder(SELL, 0, qty)
+	if err != nil {
+		d.retryTP = time.Now().Add(dcaRetryDelay)
+		logMessage("error", fmt.Sprintf("DCA take-profit sell failed, retrying in %s: %v", dcaRetryDelay, err))
+		d.placeSafetyOrders(bs, orders)
+		return
+	}
+	costSold := d.cost * math.Min(fill.Quantity/qty, 1) // The whole cycle, unless the sell only partly filled
+	profit := fill.Price*fill.Quantity - fill.Fee - costSold
+	d.realized += profit
+	d.cycles++
+	bs.tradeCount++
+	if profit > 0 {
+		bs.winCount++
+	}
+	logMessage("signal", fmt.Sprintf("🔴 DCA take-profit: sold %.6f at %.2f for $%.4f (realized $%.4f over %d cycles)", fill.Quantity, fill.Price, profit, d.realized, d.cycles))
+	plotSignalOnChart("SELL", fill.Price)
+	updateLastSignal("SELL")
+	d.quantity, d.cost, d.firstPrice = 0, 0, 0
+	updateCostBasis(0, 0)
+}
+
+func (d *DCAStrategy) OnFill(bs *BotState, orders OrderManager, fill Order) error {
+	step, ok := d.safetyOrders[fill.ID]
+	if !ok {
+		return nil
+	}
+	delete(d.safetyOrders, fill.ID)
+	d.addFill(bs, fill)
+	logMessage("signal", fmt.Sprintf("🟢 DCA safety order %d filled: %.6f at %.2f (average cost %.2f)", step, fill.Quantity, fill.Price, d.averageCost()))
+	plotSignalOnChart("BUY", fill.Price)
+	updateLastSignal("BUY")
+	return nil
+}
+
+func (d *DCAStrategy) Stop(bs *BotState, orders OrderManager) {
+	d.cancelSafetyOrders(orders)
+	if d.started {
+		logMessage("info", fmt.Sprintf("DCA stopped: holding %.6f at average cost %.2f, $%.4f realized over %d cycles.", d.quantity, d.averageCost(), d.realized, d.cycles))
+	}
+}
+
+// orderManager returns what a managed strategy works its orders through: the paper
+// exchange when trading on paper, otherwise the connector if it supports limit orders.
+func (bs *BotState) orderManager() OrderManager {
+	if bs.paper != nil {
+		return bs.paper
+	}
+	if om, ok := bs.connector.(OrderManager); ok {
+		return om
+	}
+	return nil
+}
+
+// runManaged hands new fills and the tick's price to an order-managing strategy.
+func (bs *BotState) runManaged(price float64) {
+	fills, err := bs.orders.PollFills()
+	if err != nil {
+		logMessage("warning", "Could not check order fills: "+err.Error())
+	}
+	for _, fill := range fills {
+		if err := bs.managed.OnFill(bs, bs.orders, fill); err != nil {
+			logMessage("error", "Strategy failed to handle fill: "+err.Error())
+		}
+	}
+	if err := bs.managed.OnTick(bs, bs.orders, price); err != nil {
+		logMessage("error", "Strategy error: "+err.Error())
+	}
+}
+
+// strategyFunctions returns the signal strategies by key: the built-ins and the user mods
+// compiled into this module.
+func strategyFunctions() map[string]StrategyFunction {
+	strategyExecutor := map[string]StrategyFunction{"sma_crossover": strategySMACrossover, "rsi_basic": strategyRsiBasic, "stochastic": strategyStochastic, "bollinger": strategyBollinger, "book_imbalance": strategyBookImbalance}
+	for _, m := range userMods {
+		if _, builtIn := strategyExecutor[m.Key]; !builtIn {
+			strategy := m.Strategy
+			strategyExecutor[m.Key] = func(bs *BotState) Signal { return strategy(bs.strategyView()) }
+		}
+	}
+	return strategyExecutor
+}
+
 func (bs *BotState) runStrategy() {
-	strategyExecutor := map[string]StrategyFunction{"sma_crossover": strategySMACrossover, "rsi_basic": strategyRsiBasic, "stochastic": strategyStochastic, "bollinger": strategyBollinger /* [[USER_MOD_REGISTRATION]] */}
-	strategyFunc, ok := strategyExecutor[bs.config.Strategy]
+	if bs.managed != nil {
+		bs.runManaged(bs.prices[len(bs.prices)-1])
+		return
+	}
+	strategyFunc, ok := strategyFunctions()[bs.config.Strategy]
 	if !ok {
 		logMessage("error", "Strategy not found")
 		return
@@ -674,7 +4382,25 @@ func (bs *BotState) runStrategy() {
 	signal := strategyFunc(bs)
 	if signal != HOLD {
 		price := bs.prices[len(bs.prices)-1]
-		bs.connector.PlaceOrder(bs, signal, price, bs.config.Symbol)
+		if err := bs.checkFunds(signal, price); err != nil {
+			logMessage("warning", "Skipping order: "+err.Error())
+			return
+		}
+		if err := bs.connector.PlaceOrder(bs, signal, price, bs.config.Symbol); err != nil {
+			if errors.Is(err, ErrRateLimited) {
+				logMessage("warning", "Order skipped: "+err.Error())
+				return
+			}
+			logMessage("error", "Order rejected: "+err.Error())
+			return
+		}
+		// A live order moves the account, so refresh it (and with it the position) before
+		// the next checkFunds rather than waiting for the periodic sync.
+		if bs.paper == nil {
+			if err := bs.syncBalances(); err != nil {
+				logMessage("warning", "Balance sync after order failed: "+err.Error())
+			}
+		}
 		if signal != bs.lastPosition {
 			bs.tradeCount++
 			if rand.Float64() > 0.4 {
@@ -702,6 +4428,7 @@ func plotSignalOnChart(t string, p float64) { js.Global().Call("goPlotSignal", t
 func updatePerformanceStats(t int, w, c, p float64) { js.Global().Call("goUpdatePerformanceStats", t, w, c, p) }
 func updateUptime(d time.Duration) { js.Global().Call("goUpdateUptime", d.String()) }
 func updateLastSignal(s string) { js.Global().Call("goUpdateLastSignal", s) }
+func updateCostBasis(avg, qty float64) { js.Global().Call("goUpdateCostBasis", avg, qty) }
 func updateIndicatorsOnChart(indicators map[string]float64) {
 	if len(indicators) == 0 {
 		return
@@ -712,6 +4439,17 @@ func updateIndicatorsOnChart(indicators map[string]float64) {
 	}
 	js.Global().Call("goUpdateIndicators", string(jsonData))
 }
+func publishUserMods() {
+	mods := userMods
+	if mods == nil {
+		mods = []UserMod{}
+	}
+	jsonData, err := json.Marshal(mods)
+	if err != nil {
+		return // Fail silently
+	}
+	js.Global().Call("goRegisterUserMods", string(jsonData))
+}
 
 func main() {
 	fmt.Println("Go WebAssembly module loaded.")
@@ -721,9 +4459,46 @@ func main() {
 			logMessage("error", "Invalid JSON config: "+err.Error())
 			return nil
 		}
-		bot.start()
+		// Connecting waits on network promises, which must not block the JS event loop.
+		go bot.start()
 		return nil
 	}))
 	js.Global().Set("stopBot", js.FuncOf(func(this js.Value, args []js.Value) interface{} { bot.stop(); return nil }))
+	// Hot swapping: the page exports the state from the old module and imports it into the
+	// new one. Import returns an error message, or null on success.
+	js.Global().Set("exportBotState", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		data, err := json.Marshal(bot.exportState())
+		if err != nil {
+			logMessage("error", "Failed to export bot state: "+err.Error())
+			return nil
+		}
+		return string(data)
+	}))
+	js.Global().Set("importBotState", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		var state EngineState
+		if err := json.Unmarshal([]byte(args[0].String()), &state); err != nil {
+			return "Invalid bot state: " + err.Error()
+		}
+		if err := bot.importState(state); err != nil {
+			return err.Error()
+		}
+		return nil
+	}))
+	// switchStrategy takes {"strategy": key, "strategyParams": {...}} and applies it to the
+	// running bot without a restart. Returns an error message, or null on success.
+	js.Global().Set("switchStrategy", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		var change struct {
+			Strategy       string             `json:"strategy"`
+			StrategyParams map[string]float64 `json:"strategyParams"`
+		}
+		if err := json.Unmarshal([]byte(args[0].String()), &change); err != nil {
+			return "Invalid strategy change: " + err.Error()
+		}
+		if err := bot.switchStrategy(change.Strategy, change.StrategyParams); err != nil {
+			return err.Error()
+		}
+		return nil
+	}))
+	publishUserMods()
 	<-make(chan bool)
 }
\ No newline at end of file
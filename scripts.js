@@ -9,17 +9,46 @@ const strategyParamsDiv = document.getElementById('strategy-params');
 const chartCanvas = document.getElementById('priceChart');
 const docTabContent = document.getElementById('tab-documentation');
 const modCodeTextarea = document.getElementById('mod-code');
+const modHighlights = document.getElementById('mod-code-highlights');
+const modDiagnosticsList = document.getElementById('mod-diagnostics');
 const applyModButton = document.getElementById('applyModButton');
 const validateModButton = document.getElementById('validateModButton');
+const testModButton = document.getElementById('testModButton');
+const modTestResultsDiv = document.getElementById('mod-test-results');
+const modSelect = document.getElementById('mod-select');
+const newModButton = document.getElementById('newModButton');
+const deleteModButton = document.getElementById('deleteModButton');
+const modKeyInput = document.getElementById('mod-key');
+const modNameInput = document.getElementById('mod-name');
+const modDescriptionInput = document.getElementById('mod-description');
+const modParamsTextarea = document.getElementById('mod-params');
+const librarySelect = document.getElementById('library-select');
+const libraryVersionSelect = document.getElementById('library-version');
+const libraryMessageInput = document.getElementById('library-message');
+const saveLibraryButton = document.getElementById('saveLibraryButton');
+const loadLibraryButton = document.getElementById('loadLibraryButton');
+const deleteLibraryButton = document.getElementById('deleteLibraryButton');
 const symbolSelect = document.getElementById('symbol');
 const newSymbolInput = document.getElementById('new-symbol');
 const addSymbolBtn = document.getElementById('add-symbol-btn');
 const paperTradingToggle = document.getElementById('paper-trading');
+const recordMarketDataToggle = document.getElementById('record-market-data');
+const orderBookToggle = document.getElementById('order-book');
+const confirmLiveTradingToggle = document.getElementById('confirm-live-trading');
+const environmentBadge = document.getElementById('environment-badge');
 const tickIntervalInput = document.getElementById('tick-interval');
 const tickValueSpan = document.getElementById('tick-value');
 const riskLevelSelect = document.getElementById('risk-level');
+const feedTimeoutInput = document.getElementById('feed-timeout');
+const maxPriceAgeInput = document.getElementById('max-price-age');
+const makerFeeInput = document.getElementById('maker-fee');
+const takerFeeInput = document.getElementById('taker-fee');
+const slippageModelSelect = document.getElementById('slippage-model');
+const slippageBpsInput = document.getElementById('slippage-bps');
+const payFeesBnbToggle = document.getElementById('pay-fees-bnb');
 const clearLogsBtn = document.getElementById('clearLogsBtn');
 const exportLogsBtn = document.getElementById('exportLogsBtn');
+const exportMarketDataBtn = document.getElementById('exportMarketDataBtn');
 const strategyDescription = document.getElementById('strategy-description');
 const modStatusDiv = document.getElementById('mod-status');
 const resetZoomBtn = document.getElementById('resetZoomBtn');
@@ -34,10 +63,16 @@ const currentPriceEl = document.getElementById('current-price');
 const profitLossEl = document.getElementById('profit-loss');
 const uptimeEl = document.getElementById('uptime');
 const lastSignalEl = document.getElementById('last-signal');
+const avgCostEl = document.getElementById('avg-cost');
+const positionSizeEl = document.getElementById('position-size');
 
 let priceChart;
 let originalGoCode;
+let modLibrary = [];
+let currentModIndex = 0;
+let modDiagnostics = [];
 let logs = [];
+let marketDataDB;
 
 const connectorDefinitions = {
     "simulation": { 
@@ -48,19 +83,42 @@ const connectorDefinitions = {
     "coinbase": { 
         name: "Coinbase", 
         params: { 
-            "apiKey": { label: "API Key", type: "password" }, 
-            "apiSecret": { label: "API Secret", type: "password" }, 
-            "secretPhrase": { label: "Secret Phrase", type: "password" }
+            "environment": { label: "Environment", type: "select", value: "production", options: ["production", "sandbox"], description: "The sandbox returns mocked order and account responses; prices still come from production." },
+            "apiKeyName": { label: "API Key Name", type: "text" }, 
+            "apiPrivateKey": { label: "API Private Key (PEM)", type: "password" }
         }, 
-        description: "Connects to Coinbase for live price data and executes real trades. Requires API keys with trading permissions." 
+        description: "Connects to Coinbase Advanced Trade for live price data and executes real trades. Requires a CDP API key (ES256) with trade permissions; legacy Coinbase Pro keys are no longer supported." 
     },
     "binance": { 
         name: "Binance", 
         params: { 
             "apiKey": { label: "API Key", type: "password" }, 
-            "apiSecret": { label: "API Secret", type: "password" }
+            "apiSecret": { label: "API Secret", type: "password" },
+            "environment": { label: "Environment", type: "select", value: "production", options: ["production", "testnet"], description: "Testnet uses testnet.binance.vision and needs separate testnet API keys." },
+            "recvWindow": { label: "Receive Window (ms)", type: "number", value: 5000, min: 1, max: 60000, description: "How long a signed request stays valid. Raise it on slow connections." }
         }, 
         description: "Connects to Binance for live price data and executes real trades. Requires API keys with trading permissions." 
+    },
+    "kraken": { 
+        name: "Kraken", 
+        params: { 
+            "apiKey": { label: "API Key", type: "password" }, 
+            "apiSecret": { label: "Private Key", type: "password" },
+            "restEndpoint": { label: "REST Endpoint (optional)", type: "text", description: "Override for a local stub server. Defaults to https://api.kraken.com." },
+            "wsEndpoint": { label: "WebSocket Endpoint (optional)", type: "text", description: "Defaults to wss://ws.kraken.com/v2." }
+        }, 
+        description: "Connects to Kraken's WebSocket v2 feed for live prices and places signed REST orders. Requires API keys with trading permissions." 
+    },
+    "bybit": { 
+        name: "Bybit Perpetuals", 
+        params: { 
+            "apiKey": { label: "API Key", type: "password" }, 
+            "apiSecret": { label: "API Secret", type: "password" },
+            "leverage": { label: "Leverage", type: "number", value: 2, min: 1, max: 100 },
+            "marginMode": { label: "Margin Mode", type: "text", value: "cross", description: "cross or isolated" },
+            "maxFundingRate": { label: "Max Funding Rate (%)", type: "number", value: 0.05, description: "Skip new positions that would pay more than this per funding interval. 0 disables the check." }
+        }, 
+        description: "Trades USDT linear perpetuals on Bybit. BUY goes long and SELL goes short; a signal against the open position closes it with a reduce-only order. Requires API keys with derivatives permissions." 
     }
 };
 
@@ -98,6 +156,38 @@ const strategyDefinitions = {
             "std_dev": { label: "Std. Deviations", value: 2, type: "number", min: 1, max: 3 }
         }, 
         description: "Triggers trades when the price touches the upper or lower bands. Effective in volatile markets with mean reversion." 
+    },
+    "book_imbalance": { 
+        name: "Order Book Imbalance", 
+        params: { 
+            "imbalance_threshold": { label: "Imbalance Threshold", value: 0.3, type: "number", min: 0.05, max: 0.95 }, 
+            "max_spread_bps": { label: "Max Spread (bps)", value: 10, type: "number", min: 1, max: 100 }
+        }, 
+        description: "Buys when resting bids outweigh asks near the top of the book and sells on the reverse, only while the spread is tight. Requires the Order Book setting." 
+    },
+    "grid": { 
+        name: "Grid Trading", 
+        params: { 
+            "lower_price": { label: "Lower Price", value: 90, type: "number", min: 0 }, 
+            "upper_price": { label: "Upper Price", value: 150, type: "number", min: 0 }, 
+            "grid_levels": { label: "Grid Levels", value: 10, type: "number", min: 2, max: 200 }, 
+            "level_quote": { label: "Amount per Level (quote)", value: 20, type: "number", min: 1 }
+        }, 
+        description: "Keeps a ladder of limit orders across a price range: buys below the market, sells above. Each filled buy is replaced by a sell one level up and vice versa, collecting one grid step per round trip. Works on paper with any connector and live on Binance." 
+    },
+    "dca": { 
+        name: "Dollar-Cost Averaging (DCA)", 
+        params: { 
+            "dca_amount": { label: "Amount per Buy (quote)", value: 25, type: "number", min: 1 }, 
+            "interval_hours": { label: "Interval (hours)", value: 24, type: "number", min: 0.1, description: "1 = hourly, 24 = daily, 168 = weekly (Mondays)." }, 
+            "start_hour_utc": { label: "Start Hour (UTC)", value: 9, type: "number", min: 0, max: 167, description: "Offset of the schedule, e.g. 9 for 09:00 UTC, or 33 with a weekly interval for Tuesdays 09:00." }, 
+            "buy_on_start": { label: "Buy on Start (1 = yes)", value: 1, type: "number", min: 0, max: 1 }, 
+            "safety_orders": { label: "Safety Orders", value: 0, type: "number", min: 0, max: 20 }, 
+            "safety_step_pct": { label: "Safety Step (%)", value: 2, type: "number", min: 0.1, max: 50 }, 
+            "safety_scale": { label: "Safety Size Scale", value: 1.5, type: "number", min: 1, max: 5 }, 
+            "take_profit_pct": { label: "Take Profit (%)", value: 0, type: "number", min: 0, max: 100, description: "Sell the averaged position at this gain over the average cost. 0 disables it." }
+        }, 
+        description: "Buys a fixed amount on a schedule to average into a position. Optional safety orders buy more as the price drops, and an optional take-profit sells everything above the average cost. Works on paper with any connector and live on Binance." 
     }
 };
 
@@ -194,7 +284,9 @@ function goUpdateIndicators(jsonData) {
             "sma_short": "SMA Short",
             "sma_long": "SMA Long",
             "bollinger_upper": "Bollinger Upper",
-            "bollinger_lower": "Bollinger Lower"
+            "bollinger_lower": "Bollinger Lower",
+            "best_bid": "Best Bid",
+            "best_ask": "Best Ask"
         };
 
         const datasetMap = new Map();
@@ -233,6 +325,98 @@ function goUpdateLastSignal(signal) {
     lastSignalEl.style.color = signal === 'BUY' ? '#10b981' : signal === 'SELL' ? '#ef4444' : '#94a3b8';
 }
 
+function goUpdateCostBasis(avgCost, quantity) {
+    avgCostEl.textContent = quantity > 0 ? `${avgCost.toFixed(2)}` : '—';
+    positionSizeEl.textContent = quantity > 0 ? quantity.toFixed(6) : '—';
+}
+
+// Called by each engine module on load with the user mods compiled into it, which
+// replace any mods from a previously loaded module in the strategy dropdown.
+function goRegisterUserMods(jsonData) {
+    const mods = JSON.parse(jsonData) || [];
+    strategySelect.querySelectorAll('option[data-user-mod]').forEach(opt => {
+        delete strategyDefinitions[opt.value];
+        opt.remove();
+    });
+    for (const mod of mods) {
+        const params = {};
+        for (const p of mod.params || []) {
+            params[p.key] = { label: p.label || p.key, value: p.value, type: 'number', min: p.min, max: p.max, description: p.description };
+        }
+        strategyDefinitions[mod.key] = { name: mod.name, params, description: mod.description || 'Custom strategy compiled from the User Mods tab.' };
+        const option = new Option(`${mod.name} (Mod)`, mod.key);
+        option.dataset.userMod = 'true';
+        strategySelect.add(option);
+    }
+    if (!strategySelect.value) {
+        strategySelect.selectedIndex = 0;
+        strategySelect.dispatchEvent(new Event('change'));
+    }
+}
+
+// --- Market Data Recorder ---
+// Events are stored one record per tick, partitioned by exchange, symbol and UTC day
+// so they can be exported as daily JSON-lines files for backtests and replay.
+function openMarketDataDB() {
+    if (marketDataDB) return Promise.resolve(marketDataDB);
+    return new Promise((resolve, reject) => {
+        const request = indexedDB.open('ganymede-market-data', 1);
+        request.onupgradeneeded = () => {
+            const store = request.result.createObjectStore('events', { autoIncrement: true });
+            store.createIndex('partition', 'partition', { unique: false });
+        };
+        request.onsuccess = () => {
+            marketDataDB = request.result;
+            resolve(marketDataDB);
+        };
+        request.onerror = () => reject(request.error);
+    });
+}
+
+function marketDataPartition(event) {
+    const day = new Date(event.ts).toISOString().slice(0, 10);
+    return `${event.exchange}_${event.symbol}_${day}`;
+}
+
+async function goRecordMarketEvents(jsonData) {
+    try {
+        const events = JSON.parse(jsonData);
+        const db = await openMarketDataDB();
+        const tx = db.transaction('events', 'readwrite');
+        const store = tx.objectStore('events');
+        events.forEach(event => store.add({ ...event, partition: marketDataPartition(event) }));
+    } catch (e) {
+        console.error('Failed to record market data:', e);
+    }
+}
+
+async function exportMarketData() {
+    const db = await openMarketDataDB();
+    const files = new Map();
+    await new Promise((resolve, reject) => {
+        const request = db.transaction('events', 'readonly').objectStore('events').openCursor();
+        request.onsuccess = () => {
+            const cursor = request.result;
+            if (!cursor) return resolve();
+            const { partition, ...event } = cursor.value;
+            if (!files.has(partition)) files.set(partition, []);
+            files.get(partition).push(JSON.stringify(event));
+            cursor.continue();
+        };
+        request.onerror = () => reject(request.error);
+    });
+    for (const [partition, lines] of files) {
+        const blob = new Blob([lines.join('\n') + '\n'], { type: 'application/x-ndjson' });
+        const url = URL.createObjectURL(blob);
+        const a = document.createElement('a');
+        a.href = url;
+        a.download = `${partition}.jsonl`;
+        a.click();
+        URL.revokeObjectURL(url);
+    }
+    return files.size;
+}
+
 // CORRECTED: Fixed the entire function which was broken by a syntax error
 function createParamUI(container, definitions, definitionKey) {
     container.innerHTML = '';
@@ -246,6 +430,17 @@ function createParamUI(container, definitions, definitionKey) {
     
     for (const [key, param] of Object.entries(definition.params)) {
         const paramGroup = document.createElement('div');
+        if (param.type === 'select') {
+            paramGroup.innerHTML = `
+                <label for="param-${key}" class="block text-sm font-medium text-slate-300 mb-2">${param.label}</label>
+                <select id="param-${key}" class="param-input" data-param-key="${key}">
+                    ${param.options.map(opt => `<option value="${opt}" ${opt === param.value ? 'selected' : ''}>${opt}</option>`).join('')}
+                </select>
+                ${param.description ? `<p class="mt-1 text-xs text-slate-500">${param.description}</p>` : ''}
+            `;
+            container.appendChild(paramGroup);
+            continue;
+        }
         paramGroup.innerHTML = `
             <label for="param-${key}" class="block text-sm font-medium text-slate-300 mb-2">${param.label}</label>
             <input type="${param.type}" id="param-${key}" value="${param.value || ''}" 
@@ -258,6 +453,21 @@ function createParamUI(container, definitions, definitionKey) {
     }
 }
 
+// Mirrors Config.LiveProduction in the engine so the user always sees where orders go.
+function updateEnvironmentBadge() {
+    const envInput = document.getElementById('param-environment');
+    const env = envInput ? envInput.value : 'production';
+    let label = 'PAPER', style = 'env-paper';
+    if (connectorSelect.value !== 'simulation' && !paperTradingToggle.checked) {
+        label = env === 'production' ? 'PRODUCTION — LIVE ORDERS' : env.toUpperCase();
+        style = env === 'production' ? 'env-live' : 'env-test';
+    } else if (connectorSelect.value !== 'simulation') {
+        label = `PAPER (${env.toUpperCase()} PRICES)`;
+    }
+    environmentBadge.textContent = `ENVIRONMENT: ${label}`;
+    environmentBadge.className = `text-center text-xs font-semibold p-2 rounded-lg text-white mt-4 ${style}`;
+}
+
 function updateStrategyDescription() {
     const selectedStrategy = strategySelect.value;
     const definition = strategyDefinitions[selectedStrategy];
@@ -266,6 +476,16 @@ function updateStrategyDescription() {
     }
 }
 
+// Configs saved before the Advanced Trade migration used apiKey/apiSecret/secretPhrase.
+function migrateCoinbaseParams(params) {
+    if (params.apiKeyName || params.apiPrivateKey || !params.apiKey) return params;
+    if (params.secretPhrase) {
+        goLog('warning', 'Saved Coinbase Pro keys are retired. Create a CDP API key for Advanced Trade and enter its name and private key.');
+        return {};
+    }
+    return { apiKeyName: params.apiKey, apiPrivateKey: params.apiSecret || '' };
+}
+
 function applyConfig(config) {
     // General Settings
     if (config.symbol) {
@@ -280,6 +500,12 @@ function applyConfig(config) {
     if (config.paperTrading !== undefined) {
         paperTradingToggle.checked = config.paperTrading;
     }
+    if (config.recordMarketData !== undefined) {
+        recordMarketDataToggle.checked = config.recordMarketData;
+    }
+    if (config.orderBook !== undefined) {
+        orderBookToggle.checked = config.orderBook;
+    }
     if (config.tickIntervalSeconds) {
         tickIntervalInput.value = config.tickIntervalSeconds;
         tickValueSpan.textContent = `${config.tickIntervalSeconds}s`;
@@ -287,6 +513,23 @@ function applyConfig(config) {
     if (config.riskLevel) {
         riskLevelSelect.value = config.riskLevel;
     }
+    if (config.feedTimeoutSeconds) {
+        feedTimeoutInput.value = config.feedTimeoutSeconds;
+    }
+    if (config.maxPriceAgeSeconds) {
+        maxPriceAgeInput.value = config.maxPriceAgeSeconds;
+    }
+
+    // Fees & Slippage
+    if (config.costs) {
+        makerFeeInput.value = config.costs.makerFee != null ? config.costs.makerFee * 100 : '';
+        takerFeeInput.value = config.costs.takerFee != null ? config.costs.takerFee * 100 : '';
+        slippageModelSelect.value = config.costs.slippageModel || 'fixed';
+        const bps = slippageModelSelect.value === 'fixed' ? config.costs.slippageBps
+            : slippageModelSelect.value === 'spread' ? config.costs.spreadBps : config.costs.impactBpsPer10k;
+        slippageBpsInput.value = bps != null ? bps : '';
+        payFeesBnbToggle.checked = !!config.costs.payFeesInBNB;
+    }
 
     // Connector
     if (config.connector) {
@@ -295,12 +538,18 @@ function applyConfig(config) {
         connectorSelect.dispatchEvent(new Event('change'));
         // Now that UI is built, set the values
         if (config.connectorParams) {
+            if (config.connector === 'coinbase') {
+                config.connectorParams = migrateCoinbaseParams(config.connectorParams);
+            }
             for (const [key, value] of Object.entries(config.connectorParams)) {
                 const input = document.getElementById(`param-${key}`);
                 if (input) input.value = value;
             }
         }
     }
+    // confirmLiveTrading is deliberately not restored: loading a saved config must
+    // never arm live trading on its own.
+    updateEnvironmentBadge();
 
     // Strategy
     if (config.strategy) {
@@ -332,9 +581,16 @@ function validateConfig() {
     return true; 
 }
 
+// feeOverride reads a fee input in percent. Empty keeps the exchange default; 0 is a
+// real 0% fee.
+function feeOverride(input) {
+    const pct = parseFloat(input.value);
+    return Number.isFinite(pct) ? pct / 100 : null;
+}
+
 function generateFullConfig() {
     const connectorParams = {};
-    document.querySelectorAll('#connector-params input').forEach(input => { 
+    document.querySelectorAll('#connector-params input, #connector-params select').forEach(input => { 
         connectorParams[input.dataset.paramKey] = input.value; 
     });
     
@@ -343,15 +599,35 @@ function generateFullConfig() {
         strategyParams[input.dataset.paramKey] = parseFloat(input.value); 
     });
     
+    // The single bps input feeds whichever parameter the selected slippage model uses.
+    // Left empty, it sends null so the engine keeps its default; 0 means no slippage.
+    const slippageModel = slippageModelSelect.value;
+    const slippageBps = Number.isFinite(parseFloat(slippageBpsInput.value)) ? parseFloat(slippageBpsInput.value) : null;
+    const costs = {
+        makerFee: feeOverride(makerFeeInput),
+        takerFee: feeOverride(takerFeeInput),
+        payFeesInBNB: payFeesBnbToggle.checked,
+        slippageModel: slippageModel,
+        slippageBps: slippageModel === 'fixed' ? slippageBps : null,
+        spreadBps: slippageModel === 'spread' ? slippageBps : null,
+        impactBpsPer10k: slippageModel === 'volume' ? slippageBps : null
+    };
+
     return JSON.stringify({
         symbol: symbolSelect.value.toUpperCase(), 
         tickIntervalSeconds: parseInt(tickIntervalInput.value, 10), 
+        feedTimeoutSeconds: parseInt(feedTimeoutInput.value, 10) || 30,
+        maxPriceAgeSeconds: parseInt(maxPriceAgeInput.value, 10) || 60,
         paperTrading: paperTradingToggle.checked,
+        recordMarketData: recordMarketDataToggle.checked,
+        orderBook: orderBookToggle.checked,
+        confirmLiveTrading: confirmLiveTradingToggle.checked,
         connector: connectorSelect.value, 
         connectorParams: connectorParams,
         strategy: strategySelect.value, 
         strategyParams: strategyParams,
-        riskLevel: riskLevelSelect.value
+        riskLevel: riskLevelSelect.value,
+        costs: costs
     }, null, 4);
 }
 
@@ -407,6 +683,24 @@ function initializeChart() {
                     pointRadius: 0,
                     hidden: true,
                 },
+                {
+                    label: 'Best Bid',
+                    data: [],
+                    borderColor: '#34d399', // Emerald-400
+                    borderWidth: 1,
+                    stepped: true,
+                    pointRadius: 0,
+                    fill: false,
+                },
+                {
+                    label: 'Best Ask',
+                    data: [],
+                    borderColor: '#f87171', // Red-400
+                    borderWidth: 1,
+                    stepped: true,
+                    pointRadius: 0,
+                    fill: false,
+                },
                 {
                     label: 'Bollinger Upper',
                     data: [],
@@ -498,9 +792,13 @@ function populateDocs() {
             <p>You can write your own trading strategies in Go:</p>
             <ol class="list-decimal list-inside space-y-2 text-sm">
                 <li>Go to the "User Mods" tab</li>
-                <li>Write your Go function named <code>strategyUserMod</code></li>
-                <li>Click "Validate" to check syntax</li>
-                <li>Click "Apply Mod & Recompile" to inject your code</li>
+                <li>Write your Go function <code>func strategyUserMod(s StrategyView) Signal</code> (helper functions and types are fine, as long as their names don't clash with the engine's)</li>
+                <li>Read the market through <code>s</code>: <code>s.Prices</code> (oldest first), <code>s.Params</code>, <code>s.Book</code>, <code>s.BookReady</code>, <code>s.LastSignal</code> and <code>s.Symbol</code>. The indicator helpers <code>sma</code>, <code>rsi</code>, <code>stochastic</code> and <code>bollingerBands</code> can be called too; engine code that talks to the page or the network cannot</li>
+                <li>Don't add imports: <code>math</code>, <code>math/rand</code>, <code>sort</code>, <code>strings</code>, <code>strconv</code>, <code>fmt</code>, <code>errors</code> and <code>time</code> are available automatically</li>
+                <li>Click "Validate" to check your code; errors point at lines in the editor</li>
+                <li>Click "Test" to run your mods over uptrend, downtrend, range and crash price series and see their signals and a quick backtest</li>
+                <li>Give each mod its own strategy key and, optionally, parameters; use "New" to add more mods</li>
+                <li>Click "Apply Mods &amp; Recompile" to build all of your mods into the engine</li>
                 <li>Select "User Mod (Custom)" in strategy dropdown</li>
             </ol>
         </div>
@@ -509,13 +807,13 @@ function populateDocs() {
             <h4>📝 Strategy Template</h4>
             <p>Copy this template to get started with custom strategies:</p>
             <pre><code>// Example: Buy when price increases, sell when it decreases
-func strategyUserMod(bs *BotState) Signal {
-    if len(bs.prices) &lt; 2 {
+func strategyUserMod(s StrategyView) Signal {
+    if len(s.Prices) &lt; 2 {
         return HOLD // Need at least 2 price points
     }
     
-    currentPrice := bs.prices[len(bs.prices)-1]
-    previousPrice := bs.prices[len(bs.prices)-2]
+    currentPrice := s.Prices[len(s.Prices)-1]
+    previousPrice := s.Prices[len(s.Prices)-2]
     
     // Simple momentum strategy
     if currentPrice &gt; previousPrice * 1.01 {
@@ -525,6 +823,23 @@ func strategyUserMod(bs *BotState) Signal {
         return SELL
     }
     return HOLD
+}</code></pre>
+        </div>
+
+        <div class="doc-section">
+            <h4>📚 Order Book Data</h4>
+            <p>With the Order Book setting enabled, strategies can read the live L2 book through <code>s.Book</code> whenever <code>s.BookReady</code> is true: <code>BestBid</code>, <code>BestAsk</code>, <code>BidSize</code>, <code>AskSize</code>, <code>Spread</code>, <code>SpreadBps</code>, <code>Mid</code> and <code>Imbalance</code> (-1 all asks to +1 all bids, over the top 10 levels).</p>
+            <pre><code>func strategyUserMod(s StrategyView) Signal {
+    if !s.BookReady || s.Book.SpreadBps &gt; 5 {
+        return HOLD // No book yet, or too wide to trade
+    }
+    if s.Book.Imbalance &gt; 0.4 {
+        return BUY
+    }
+    if s.Book.Imbalance &lt; -0.4 {
+        return SELL
+    }
+    return HOLD
 }</code></pre>
         </div>
     `;
@@ -550,6 +865,287 @@ async function loadWasm(url) {
     }
 }
 
+// switchRunningStrategy applies the selected strategy and its parameters to a running bot
+// from its next tick, without stopping it.
+function switchRunningStrategy() {
+    if (stopButton.disabled || !window.switchStrategy) return;
+    const config = JSON.parse(generateFullConfig());
+    const error = window.switchStrategy(JSON.stringify({ strategy: config.strategy, strategyParams: config.strategyParams }));
+    if (error) goLog('warning', `Strategy not switched: ${error}`);
+}
+
+// --- Mod Library ---
+// All mods live in localStorage and are compiled together, so every mod stays
+// available in the strategy dropdown after any one of them is changed.
+function loadModLibrary() {
+    try {
+        modLibrary = JSON.parse(localStorage.getItem('userMods')) || [];
+    } catch (e) {
+        modLibrary = [];
+    }
+    if (modLibrary.length === 0) {
+        modLibrary.push({ key: 'user_mod', name: 'User Mod (Custom)', description: '', params: '', code: '' });
+    }
+    currentModIndex = 0;
+    renderModSelect();
+    showMod(currentModIndex);
+}
+
+function saveModLibrary() {
+    localStorage.setItem('userMods', JSON.stringify(modLibrary));
+}
+
+function renderModSelect() {
+    modSelect.innerHTML = '';
+    modLibrary.forEach((mod, i) => modSelect.add(new Option(`${mod.name || mod.key || 'Untitled'} (${mod.key})`, i)));
+    modSelect.value = currentModIndex;
+}
+
+function showMod(index) {
+    const mod = modLibrary[index];
+    modKeyInput.value = mod.key;
+    modNameInput.value = mod.name;
+    modDescriptionInput.value = mod.description;
+    modParamsTextarea.value = mod.params;
+    modCodeTextarea.value = mod.code;
+    renderModHighlights();
+}
+
+// --- Mod Diagnostics ---
+// Diagnostics from /validate and /compile carry editor line and column numbers for each
+// mod. They are listed under the editor and underlined in the current mod's code.
+function escapeHTML(text) {
+    return text.replace(/[&<>"']/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;' }[c]));
+}
+
+function showModDiagnostics(diagnostics) {
+    modDiagnostics = diagnostics;
+    modDiagnosticsList.innerHTML = '';
+    for (const d of diagnostics) {
+        const item = document.createElement('li');
+        item.className = d.severity === 'warning' ? 'diag-warning' : 'diag-error';
+        const where = d.line > 0 ? ` line ${d.line}${d.column ? `:${d.column}` : ''}` : '';
+        item.textContent = `${d.severity === 'warning' ? 'warning' : 'error'}: ${d.mod || d.file || ''}${where}: ${d.message}`;
+        item.addEventListener('click', () => jumpToDiagnostic(d));
+        modDiagnosticsList.appendChild(item);
+    }
+    renderModHighlights();
+}
+
+function renderModHighlights() {
+    const key = modLibrary[currentModIndex] ? modLibrary[currentModIndex].key : '';
+    const byLine = new Map();
+    for (const d of modDiagnostics) {
+        if (d.mod !== key || d.line < 1) continue;
+        // Errors win over warnings on the same line.
+        if (!byLine.has(d.line) || d.severity !== 'warning') byLine.set(d.line, d);
+    }
+    const lines = modCodeTextarea.value.split('\n');
+    modHighlights.innerHTML = lines.map((line, i) => {
+        const d = byLine.get(i + 1);
+        if (!d) return escapeHTML(line);
+        const start = d.column ? Math.min(d.column - 1, line.length) : line.search(/\S|$/);
+        const token = line.slice(start).match(/^[\w.]+|^\S/);
+        const end = d.column && token ? start + token[0].length : line.length;
+        const cls = d.severity === 'warning' ? 'diag-warning' : 'diag-error';
+        return escapeHTML(line.slice(0, start)) + `<span class="${cls}">${escapeHTML(line.slice(start, end) || ' ')}</span>` + escapeHTML(line.slice(end));
+    }).join('\n') + '\n';
+    modHighlights.scrollTop = modCodeTextarea.scrollTop;
+}
+
+function jumpToDiagnostic(d) {
+    const index = modLibrary.findIndex(mod => mod.key === d.mod);
+    if (index < 0 || d.line < 1) return;
+    if (index !== currentModIndex) {
+        currentModIndex = index;
+        modSelect.value = index;
+        showMod(index);
+    }
+    const lines = modCodeTextarea.value.split('\n');
+    let offset = 0;
+    for (let i = 0; i < d.line - 1 && i < lines.length; i++) offset += lines[i].length + 1;
+    const lineLength = (lines[d.line - 1] || '').length;
+    modCodeTextarea.focus();
+    modCodeTextarea.setSelectionRange(offset + Math.min((d.column || 1) - 1, lineLength), offset + lineLength);
+    const lineHeight = parseFloat(getComputedStyle(modCodeTextarea).lineHeight) || 20;
+    modCodeTextarea.scrollTop = Math.max(0, (d.line - 3) * lineHeight);
+}
+
+function storeCurrentMod() {
+    modLibrary[currentModIndex] = {
+        key: modKeyInput.value.trim(),
+        name: modNameInput.value.trim(),
+        description: modDescriptionInput.value.trim(),
+        params: modParamsTextarea.value,
+        code: modCodeTextarea.value
+    };
+    saveModLibrary();
+    modSelect.options[currentModIndex].textContent = `${modNameInput.value.trim() || modKeyInput.value.trim() || 'Untitled'} (${modKeyInput.value.trim()})`;
+}
+
+// toModSpec converts an editor mod to the server's ModSpec, turning the parameter
+// schema from the editor's object form into the server's ordered list.
+function toModSpec(mod) {
+    let params = {};
+    if (mod.params.trim()) {
+        try {
+            params = JSON.parse(mod.params);
+        } catch (e) {
+            throw new Error(`${mod.key}: parameters are not valid JSON: ${e.message}`);
+        }
+    }
+    return {
+        key: mod.key,
+        name: mod.name,
+        description: mod.description,
+        params: Object.entries(params).map(([key, p]) => ({ key, label: p.label || key, value: Number(p.value) || 0, min: p.min, max: p.max, description: p.description })),
+        code: mod.code
+    };
+}
+
+function fromModSpec(spec) {
+    const params = {};
+    for (const p of spec.params || []) {
+        params[p.key] = { label: p.label, value: p.value, min: p.min, max: p.max, description: p.description };
+    }
+    return {
+        key: spec.key,
+        name: spec.name,
+        description: spec.description || '',
+        params: Object.keys(params).length ? JSON.stringify(params, null, 2) : '',
+        code: spec.code
+    };
+}
+
+function modRequest() {
+    return { mods: modLibrary.map(toModSpec) };
+}
+
+// API calls go through apiFetch, which sends the bearer token the server asked for, if
+// any. A 401 asks for the token once and retries; basic auth is left to the browser.
+async function apiFetch(url, options = {}) {
+    const send = () => {
+        const token = localStorage.getItem('apiToken');
+        const headers = { ...(options.headers || {}) };
+        if (token) headers['Authorization'] = `Bearer ${token}`;
+        return fetch(url, { ...options, headers });
+    };
+    let response = await send();
+    if (response.status === 401 && /Bearer/.test(response.headers.get('WWW-Authenticate') || '')) {
+        const token = prompt('The compile server requires an API token:');
+        if (token) {
+            localStorage.setItem('apiToken', token.trim());
+            response = await send();
+        }
+    }
+    return response;
+}
+
+// Builds run as server-side jobs. Submitting with ?async=1 returns the job straight away,
+// and polling /jobs/<id> keeps long builds clear of HTTP timeouts. Resolves to the
+// compile response, which also carries rate limit and queue errors. Extra fields are
+// sent alongside the mods.
+// The async build job this page is waiting on, canceled if the page is closed mid-build.
+let pendingBuildJob = null;
+window.addEventListener('pagehide', () => {
+    if (pendingBuildJob) {
+        apiFetch(`/jobs/${pendingBuildJob}`, { method: 'DELETE', keepalive: true }).catch(() => {});
+    }
+});
+
+async function runBuildJob(path, label, extra = {}) {
+    const response = await apiFetch(`${path}?async=1`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ ...modRequest(), ...extra })
+    });
+    const body = await response.json().catch(() => ({ success: false, error: response.statusText }));
+    if (response.status !== 202) {
+        if (response.status === 429 || response.status === 503) {
+            const retry = response.headers.get('Retry-After');
+            body.error = `${body.error}${retry ? ` (retry in ${retry}s)` : ''}`;
+        }
+        return body;
+    }
+
+    let job = body;
+    pendingBuildJob = job.id;
+    try {
+        while (!job.result) {
+            updateModStatus('info', job.status === 'queued'
+                ? `${label} queued (position ${job.position || 1})...`
+                : `${label} in progress... This may take a moment.`);
+            await new Promise(resolve => setTimeout(resolve, 1000));
+            const poll = await apiFetch(`/jobs/${job.id}`);
+            if (!poll.ok) return { success: false, error: `Lost track of build job ${job.id}` };
+            job = await poll.json();
+        }
+        return job.result;
+    } finally {
+        pendingBuildJob = null;
+    }
+}
+
+// --- Server Library ---
+async function refreshServerLibrary(selectKey) {
+    try {
+        const response = await apiFetch('/library');
+        if (!response.ok) throw new Error(response.statusText);
+        const entries = await response.json();
+        librarySelect.innerHTML = '';
+        for (const entry of entries) {
+            librarySelect.add(new Option(`${entry.name} (${entry.key}) — v${entry.latestVersion}`, entry.key));
+        }
+        if (selectKey) librarySelect.value = selectKey;
+        await refreshLibraryVersions();
+    } catch (err) {
+        librarySelect.innerHTML = '';
+        libraryVersionSelect.innerHTML = '';
+        console.error('Failed to load mod library:', err);
+    }
+}
+
+async function refreshLibraryVersions() {
+    libraryVersionSelect.innerHTML = '';
+    if (!librarySelect.value) return;
+    const response = await apiFetch(`/library/${encodeURIComponent(librarySelect.value)}/versions`);
+    if (!response.ok) return;
+    for (const v of await response.json()) {
+        const saved = new Date(v.savedAt).toLocaleString();
+        libraryVersionSelect.add(new Option(`v${v.version} — ${saved}${v.message ? ` — ${v.message}` : ''}`, v.version));
+    }
+}
+
+// Test results from /test: a row per mod and series with the backtest summary and the
+// signals drawn as a strip, BUY in green and SELL in red.
+function showModTestResults(tests) {
+    if (!tests || !tests.length) {
+        modTestResultsDiv.innerHTML = '';
+        modTestResultsDiv.classList.add('hidden');
+        return;
+    }
+    const pct = v => `<span class="${v > 0 ? 'test-positive' : v < 0 ? 'test-negative' : ''}">${v.toFixed(2)}%</span>`;
+    const rows = tests.map(t => {
+        const s = t.summary;
+        const strip = t.signals.map(sig => `<span class="${sig === 'BUY' ? 'sig-buy' : sig === 'SELL' ? 'sig-sell' : ''}"></span>`).join('');
+        const error = t.error ? `<div class="test-negative">${escapeHTML(t.error)}</div>` : '';
+        return `<tr>
+            <td>${escapeHTML(t.mod)} / ${escapeHTML(t.series)}${error}</td>
+            <td class="test-signals" title="${s.buys} BUY, ${s.sells} SELL over ${s.ticks} ticks">${strip}</td>
+            <td>${s.trades}</td>
+            <td>${s.winRate.toFixed(0)}%</td>
+            <td>${pct(s.returnPct)}</td>
+            <td>${pct(s.buyHoldPct)}</td>
+            <td>${s.maxDrawdownPct.toFixed(2)}%</td>
+        </tr>`;
+    }).join('');
+    modTestResultsDiv.innerHTML = `<table>
+        <thead><tr><th>Mod / Series</th><th>Signals</th><th>Trades</th><th>Win</th><th>Return</th><th>Buy &amp; Hold</th><th>Max DD</th></tr></thead>
+        <tbody>${rows}</tbody>
+    </table>`;
+    modTestResultsDiv.classList.remove('hidden');
+}
+
 function updateModStatus(level, message) {
     modStatusDiv.innerHTML = '';
     modStatusDiv.className = `alert alert-${level} text-sm`;
@@ -620,13 +1216,21 @@ document.addEventListener('DOMContentLoaded', async () => {
     createParamUI(connectorParamsDiv, connectorDefinitions, connectorSelect.value);
     createParamUI(strategyParamsDiv, strategyDefinitions, strategySelect.value);
     updateStrategyDescription();
+    updateEnvironmentBadge();
     
     // Add other event listeners
-    connectorSelect.addEventListener('change', () => createParamUI(connectorParamsDiv, connectorDefinitions, connectorSelect.value));
+    connectorSelect.addEventListener('change', () => {
+        createParamUI(connectorParamsDiv, connectorDefinitions, connectorSelect.value);
+        updateEnvironmentBadge();
+    });
+    connectorParamsDiv.addEventListener('change', updateEnvironmentBadge);
+    paperTradingToggle.addEventListener('change', updateEnvironmentBadge);
     strategySelect.addEventListener('change', () => {
         createParamUI(strategyParamsDiv, strategyDefinitions, strategySelect.value);
         updateStrategyDescription();
+        switchRunningStrategy();
     });
+    strategyParamsDiv.addEventListener('change', switchRunningStrategy);
 
     addSymbolBtn.addEventListener('click', () => {
         const newSymbol = newSymbolInput.value.trim().toUpperCase();
@@ -717,6 +1321,19 @@ document.addEventListener('DOMContentLoaded', async () => {
         goLog('info', 'Logs exported.');
     });
 
+    exportMarketDataBtn.addEventListener('click', async () => {
+        try {
+            const count = await exportMarketData();
+            if (count === 0) {
+                goLog('warning', 'No recorded market data to export.');
+                return;
+            }
+            goLog('info', `Exported ${count} market data file(s).`);
+        } catch (error) {
+            goLog('error', `Failed to export market data: ${error}`);
+        }
+    });
+
     startButton.addEventListener('click', () => {
         if (!validateConfig()) return;
         
@@ -732,85 +1349,239 @@ document.addEventListener('DOMContentLoaded', async () => {
         }
     });
 
+    loadModLibrary();
+    modSelect.addEventListener('change', () => {
+        currentModIndex = Number(modSelect.value);
+        showMod(currentModIndex);
+    });
+    [modKeyInput, modNameInput, modDescriptionInput, modParamsTextarea, modCodeTextarea].forEach(input => input.addEventListener('input', storeCurrentMod));
+    modCodeTextarea.addEventListener('input', renderModHighlights);
+    modCodeTextarea.addEventListener('scroll', () => { modHighlights.scrollTop = modCodeTextarea.scrollTop; });
+    newModButton.addEventListener('click', () => {
+        let n = modLibrary.length + 1;
+        while (modLibrary.some(mod => mod.key === `user_mod_${n}`)) n++;
+        modLibrary.push({ key: `user_mod_${n}`, name: `User Mod ${n}`, description: '', params: '', code: '' });
+        currentModIndex = modLibrary.length - 1;
+        saveModLibrary();
+        renderModSelect();
+        showMod(currentModIndex);
+    });
+    deleteModButton.addEventListener('click', () => {
+        if (modLibrary.length === 1) {
+            updateModStatus('warning', 'At least one mod is needed. Clear its code instead.');
+            return;
+        }
+        if (!confirm(`Delete mod "${modLibrary[currentModIndex].key}"? It stays loaded until the next recompile.`)) return;
+        modLibrary.splice(currentModIndex, 1);
+        currentModIndex = Math.min(currentModIndex, modLibrary.length - 1);
+        saveModLibrary();
+        renderModSelect();
+        showMod(currentModIndex);
+    });
+
+    refreshServerLibrary();
+    librarySelect.addEventListener('change', refreshLibraryVersions);
+    saveLibraryButton.addEventListener('click', async () => {
+        const mod = modLibrary[currentModIndex];
+        try {
+            const spec = toModSpec(mod);
+            const response = await apiFetch(`/library/${encodeURIComponent(mod.key)}`, {
+                method: 'PUT',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ ...spec, message: libraryMessageInput.value.trim() })
+            });
+            if (!response.ok) {
+                const text = await response.text();
+                let message = text;
+                try { message = JSON.parse(text).error || text; } catch (e) { /* plain text error */ }
+                throw new Error(message);
+            }
+            const stored = await response.json();
+            libraryMessageInput.value = '';
+            updateModStatus('success', response.status === 201
+                ? `Saved ${stored.key} as version ${stored.version}.`
+                : `${stored.key} is unchanged since version ${stored.version}.`);
+            await refreshServerLibrary(stored.key);
+        } catch (err) {
+            updateModStatus('error', `Failed to save mod: ${err.message}`);
+        }
+    });
+    loadLibraryButton.addEventListener('click', async () => {
+        if (!librarySelect.value) return;
+        try {
+            const version = libraryVersionSelect.value;
+            const response = await apiFetch(`/library/${encodeURIComponent(librarySelect.value)}/versions/${version}`);
+            if (!response.ok) throw new Error(response.statusText);
+            const stored = await response.json();
+            const mod = fromModSpec(stored);
+            const existing = modLibrary.findIndex(m => m.key === mod.key);
+            if (existing >= 0) {
+                modLibrary[existing] = mod;
+                currentModIndex = existing;
+            } else {
+                modLibrary.push(mod);
+                currentModIndex = modLibrary.length - 1;
+            }
+            saveModLibrary();
+            renderModSelect();
+            showMod(currentModIndex);
+            updateModStatus('success', `Loaded ${stored.key} version ${stored.version}. Recompile to use it.`);
+        } catch (err) {
+            updateModStatus('error', `Failed to load mod: ${err.message}`);
+        }
+    });
+    deleteLibraryButton.addEventListener('click', async () => {
+        const key = librarySelect.value;
+        if (!key || !confirm(`Delete "${key}" and all of its versions from the server library?`)) return;
+        try {
+            const response = await apiFetch(`/library/${encodeURIComponent(key)}`, { method: 'DELETE' });
+            if (!response.ok) throw new Error(response.statusText);
+            updateModStatus('success', `Deleted ${key} from the server library.`);
+            await refreshServerLibrary();
+        } catch (err) {
+            updateModStatus('error', `Failed to delete mod: ${err.message}`);
+        }
+    });
+
     validateModButton.addEventListener('click', async () => {
-        const userCode = modCodeTextarea.value;
-        if (!userCode.trim()) {
+        if (modLibrary.every(mod => !mod.code.trim())) {
             updateModStatus('warning', 'Code is empty. Nothing to validate.');
             return;
         }
     
-        updateModStatus('info', 'Validating your strategy...');
+        updateModStatus('info', 'Validating your strategies...');
+        showModDiagnostics([]);
         applyModButton.disabled = true;
         validateModButton.disabled = true;
     
         try {
-            const response = await fetch('/validate', {
-                method: 'POST',
-                headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify({ code: userCode })
-            });
-    
-            const result = await response.json();
-            if (!response.ok || !result.success) {
+            const result = await runBuildJob('/validate', 'Validation');
+            showModDiagnostics(result.diagnostics || []);
+            if (!result.success) {
                 throw new Error(result.error || 'Unknown validation error');
             }
     
-            updateModStatus('success', 'Validation successful! Your code looks good.');
+            const warnings = modDiagnostics.length;
+            updateModStatus(warnings ? 'warning' : 'success', warnings
+                ? `Validation successful, with ${warnings} go vet warning(s) listed under the editor.`
+                : `Validation successful! All ${modLibrary.length} mod(s) look good.`);
     
         } catch (err) {
-            updateModStatus('error', 'Validation Failed. See compiler output below:');
-            const errorDetail = document.createElement('pre');
-            errorDetail.className = 'mt-2 p-3 bg-slate-900/80 rounded-lg text-xs whitespace-pre-wrap';
-            errorDetail.textContent = err.message;
-            modStatusDiv.appendChild(errorDetail);
+            if (modDiagnostics.length) {
+                updateModStatus('error', 'Validation Failed. The problems are listed under the editor.');
+            } else {
+                updateModStatus('error', 'Validation Failed. See compiler output below:');
+                const errorDetail = document.createElement('pre');
+                errorDetail.className = 'mt-2 p-3 bg-slate-900/80 rounded-lg text-xs whitespace-pre-wrap';
+                errorDetail.textContent = err.message;
+                modStatusDiv.appendChild(errorDetail);
+            }
         } finally {
             applyModButton.disabled = false;
             validateModButton.disabled = false;
         }
     });
 
+    testModButton.addEventListener('click', async () => {
+        if (modLibrary.every(mod => !mod.code.trim())) {
+            updateModStatus('warning', 'Code is empty. Nothing to test.');
+            return;
+        }
+
+        updateModStatus('info', 'Testing your strategies against the built-in scenarios...');
+        showModDiagnostics([]);
+        showModTestResults([]);
+        testModButton.disabled = true;
+
+        try {
+            // Backtest with the fees and slippage of the connector set up in Settings.
+            const config = JSON.parse(generateFullConfig());
+            const result = await runBuildJob('/test', 'Test run', { test: { connector: config.connector, costs: config.costs } });
+            showModDiagnostics(result.diagnostics || []);
+            if (!result.success) {
+                throw new Error(result.error || 'Unknown test error');
+            }
+            showModTestResults(result.tests);
+            const panics = result.tests.filter(t => t.error).length;
+            updateModStatus(panics ? 'warning' : 'success', panics
+                ? `Tests finished, but ${panics} run(s) panicked. Details are in the table below.`
+                : 'Tests finished. Each mod was run over uptrend, downtrend, range and crash scenarios, with the fees and slippage from Settings.');
+        } catch (err) {
+            if (modDiagnostics.length) {
+                updateModStatus('error', 'Tests could not run. The problems are listed under the editor.');
+            } else {
+                updateModStatus('error', 'Tests Failed. See output below:');
+                const errorDetail = document.createElement('pre');
+                errorDetail.className = 'mt-2 p-3 bg-slate-900/80 rounded-lg text-xs whitespace-pre-wrap';
+                errorDetail.textContent = err.message;
+                modStatusDiv.appendChild(errorDetail);
+            }
+        } finally {
+            testModButton.disabled = false;
+        }
+    });
+
     applyModButton.addEventListener('click', async () => {
-        const userCode = modCodeTextarea.value;
-        if (!userCode.trim()) {
+        if (modLibrary.every(mod => !mod.code.trim())) {
             updateModStatus('warning', 'Code is empty.');
             return;
         }
 
-        updateModStatus('info', 'Compiling your strategy... This may take a moment.');
+        updateModStatus('info', 'Compiling your strategies... This may take a moment.');
+        showModDiagnostics([]);
         applyModButton.disabled = true;
         validateModButton.disabled = true;
 
         try {
-            const response = await fetch('/compile', {
-                method: 'POST',
-                headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify({ code: userCode })
-            });
-
-            const result = await response.json();
-            if (!response.ok || !result.success) {
+            const result = await runBuildJob('/compile', 'Compilation');
+            showModDiagnostics(result.diagnostics || []);
+            if (!result.success) {
                 throw new Error(result.error || 'Unknown compilation error');
             }
 
-            updateModStatus('success', `Compilation successful! New module at ${result.url}. Loading...`);
+            updateModStatus('success', result.cached
+                ? `Mods unchanged, reusing module ${result.url}. Loading...`
+                : `Compilation successful! New module at ${result.url}. Loading...`);
             
-            if (window.stopBot && !stopButton.disabled) {
-                goLog('info', 'Stopping current bot to load new module...');
+            // Hand the bot's state to the new module so it resumes where this one stopped.
+            // Grid and DCA track their own orders, which can't be handed over, so those
+            // bots stay stopped.
+            const wasRunning = !stopButton.disabled;
+            const state = window.exportBotState ? window.exportBotState() : null;
+            const managed = state ? JSON.parse(state).managed : null;
+            if (window.stopBot && wasRunning) {
+                goLog('info', 'Pausing the bot to load the new module...');
                 window.stopBot();
             }
 
             await loadWasm(result.url);
 
-            strategySelect.querySelector('option[value="user_mod"]').hidden = false;
-            strategySelect.value = 'user_mod';
-            strategySelect.dispatchEvent(new Event('change'));
-            goLog('success', 'Custom strategy loaded. Select "User Mod (Custom)" and start the bot.');
+            if (state && window.importBotState) {
+                const importError = window.importBotState(state);
+                if (importError) goLog('warning', `Could not carry the bot state over: ${importError}`);
+            }
+            if (wasRunning && managed) {
+                startButton.disabled = false;
+                stopButton.disabled = true;
+                goLog('warning', `${modLibrary.length} custom strategy mod(s) loaded. The ${managed} strategy's open orders and cost basis can't be carried into the new module, so the bot was left stopped. Start it again to set ${managed} up afresh.`);
+            } else if (wasRunning) {
+                window.startBot(generateFullConfig());
+                goLog('success', `${modLibrary.length} custom strategy mod(s) loaded. The bot resumed with its history, stats and paper balances.`);
+            } else {
+                strategySelect.value = modLibrary[currentModIndex].key;
+                strategySelect.dispatchEvent(new Event('change'));
+                goLog('success', `${modLibrary.length} custom strategy mod(s) loaded. Pick one from the strategy dropdown and start the bot.`);
+            }
         } catch (err) {
-            updateModStatus('error', 'Compilation Failed. See compiler output below:');
-            const errorDetail = document.createElement('pre');
-            errorDetail.className = 'mt-2 p-3 bg-slate-900/80 rounded-lg text-xs whitespace-pre-wrap';
-            errorDetail.textContent = err.message;
-            modStatusDiv.appendChild(errorDetail);
+            if (modDiagnostics.length) {
+                updateModStatus('error', 'Compilation Failed. The problems are listed under the editor.');
+            } else {
+                updateModStatus('error', 'Compilation Failed. See compiler output below:');
+                const errorDetail = document.createElement('pre');
+                errorDetail.className = 'mt-2 p-3 bg-slate-900/80 rounded-lg text-xs whitespace-pre-wrap';
+                errorDetail.textContent = err.message;
+                modStatusDiv.appendChild(errorDetail);
+            }
             goLog('error', 'Custom strategy compilation failed.');
         } finally {
             applyModButton.disabled = false;
@@ -2,168 +2,2882 @@ package main
 
 import (
 	"bytes"
+	"context"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
 	"io/ioutil"
 	"log"
+	"math"
+	"math/rand"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// CompileRequest carries the mods to build into one engine module, given inline or as
+// references to versions in the mod library. Code is the older single-mod form and is
+// registered under the "user_mod" key.
 type CompileRequest struct {
-	Code string `json:"code"`
+	Code    string    `json:"code,omitempty"`
+	Mods    []ModSpec `json:"mods,omitempty"`
+	Library []ModRef  `json:"library,omitempty"`
+	Test    *ModTest  `json:"test,omitempty"` // Used by /test only
+}
+
+// ModRef selects a stored mod by key. Version 0 means the latest version.
+type ModRef struct {
+	Key     string `json:"key"`
+	Version int    `json:"version,omitempty"`
+}
+
+// ModSpec is one named mod: the strategy key it registers, how the UI presents it and
+// its Go source, which must declare strategyUserMod.
+type ModSpec struct {
+	Key         string     `json:"key"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Params      []ModParam `json:"params,omitempty"`
+	Code        string     `json:"code"`
+}
+
+// ModParam is a numeric strategy parameter, read by the mod from s.Params[Key].
+type ModParam struct {
+	Key         string   `json:"key"`
+	Label       string   `json:"label"`
+	Value       float64  `json:"value"`
+	Min         *float64 `json:"min,omitempty"`
+	Max         *float64 `json:"max,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+// Limits on the mods accepted in one request.
+const (
+	maxModsPerBuild = 16
+	maxModParams    = 20
+	maxModCode      = 64 << 10 // Bytes of code in one mod
+	maxRequestBody  = 4 << 20  // Bytes in a build or library request, with room for test series
+)
+
+// decodeBody decodes a JSON request body of at most maxRequestBody bytes. On failure it
+// answers the request itself and returns false.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody)).Decode(v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, fmt.Sprintf("Request body is larger than %d bytes", maxRequestBody), http.StatusRequestEntityTooLarge)
+	case err != nil:
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	}
+	return err == nil
+}
+
+// modKeyPattern restricts strategy and parameter keys to names that are safe in file
+// names, config files and HTML ids.
+var modKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+// specs returns the mods in the request, mapping the single-mod form to "user_mod" and
+// loading library references from the mod library.
+func (r *CompileRequest) specs() ([]ModSpec, error) {
+	specs := append([]ModSpec(nil), r.Mods...)
+	if len(specs) == 0 && len(r.Library) == 0 && strings.TrimSpace(r.Code) != "" {
+		specs = append(specs, ModSpec{Key: "user_mod", Name: "User Mod (Custom)", Description: "Custom strategy compiled from the User Mods tab.", Code: r.Code})
+	}
+	var diags []Diagnostic
+	for _, ref := range r.Library {
+		stored, err := loadStoredMod(ref.Key, ref.Version)
+		if err != nil {
+			diags = append(diags, Diagnostic{Mod: ref.Key, Message: err.Error()})
+			continue
+		}
+		specs = append(specs, stored.ModSpec)
+	}
+	if len(diags) > 0 {
+		return nil, &ModError{Diagnostics: diags}
+	}
+	return specs, nil
 }
 
 type CompileResponse struct {
-	Success bool   `json:"success"`
-	URL     string `json:"url,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Success     bool            `json:"success"`
+	URL         string          `json:"url,omitempty"`
+	Hash        string          `json:"hash,omitempty"`
+	Cached      bool            `json:"cached,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Diagnostics []Diagnostic    `json:"diagnostics,omitempty"`
+	Tests       []ModTestResult `json:"tests,omitempty"`
+}
+
+// Diagnostic is a single problem found while checking, compiling or vetting mods.
+// Mod is the key of the mod it belongs to and File the build file it was found in. For
+// mod files, Line and Column refer to the mod as typed in the editor rather than to the
+// generated file; for the engine (main.go) they refer to the template. Line is 0 when a
+// problem cannot be tied to a line, e.g. a bad parameter schema.
+type Diagnostic struct {
+	Mod      string `json:"mod,omitempty"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// Diagnostic severities. Errors fail the build; warnings come from go vet and don't.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+func (d Diagnostic) String() string {
+	msg := d.Message
+	switch {
+	case d.Line > 0 && d.Column > 0:
+		msg = fmt.Sprintf("line %d:%d: %s", d.Line, d.Column, d.Message)
+	case d.Line > 0:
+		msg = fmt.Sprintf("line %d: %s", d.Line, d.Message)
+	}
+	if d.Severity == SeverityWarning {
+		msg = "warning: " + msg
+	}
+	switch {
+	case d.Mod != "":
+		return d.Mod + ": " + msg
+	case d.File != "":
+		return d.File + ": " + msg
+	}
+	return msg
+}
+
+func modFileName(key string) string {
+	return "mod_" + key + ".go"
+}
+
+// located fills in the file and severity of diagnostics that don't set them.
+func located(diags []Diagnostic, severity string) []Diagnostic {
+	for i := range diags {
+		if diags[i].File == "" && diags[i].Mod != "" {
+			diags[i].File = modFileName(diags[i].Mod)
+		}
+		if diags[i].Severity == "" {
+			diags[i].Severity = severity
+		}
+	}
+	return diags
+}
+
+// ModError is returned when a mod fails validation or compilation.
+type ModError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *ModError) Error() string {
+	lines := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		lines[i] = d.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Limits for a single mod build. The compiler only ever sees the engine plus a few small
+// mod files, so these leave plenty of headroom while stopping runaway or hostile builds.
+const (
+	buildTimeout    = 60 * time.Second
+	buildCPUSeconds = 60
+	buildMemory     = 4 << 30 // Address-space cap for the go tool, in bytes
+	buildMemLimit   = "1GiB"  // GOMEMLIMIT soft target for the compiler
+	buildMaxProcs   = "2"
+)
+
+// allowedModPackages are the packages a mod may reference, keyed by import path.
+// Everything else the template imports (syscall/js, crypto, net/url) stays off limits.
+// Engine code that reaches syscall/js is off limits too (see restrictedNames).
+var allowedModPackages = map[string]bool{
+	"errors":    true,
+	"fmt":       true,
+	"math":      true,
+	"math/rand": true,
+	"sort":      true,
+	"strconv":   true,
+	"strings":   true,
+	"time":      true,
+}
+
+// modEntryPoint is the function every mod must declare. Each mod is written to its own
+// file, so the entry point is renamed per mod (see entryPointName) and registered with
+// the engine from a generated init function.
+const modEntryPoint = "strategyUserMod"
+
+// entryPointName is the name mod i's entry point is compiled under. It has the same
+// length as modEntryPoint so compiler columns on renamed lines still match the editor.
+func entryPointName(i int) string {
+	return fmt.Sprintf("strategyMod%04d", i)
+}
+
+// reservedModNames may not be declared by a mod even though the template does not
+// declare them at the top level.
+var reservedModNames = map[string]bool{
+	"main": true,
+	"init": true,
+}
+
+// templateSymbols describes the top-level names of main.go that a mod must not redeclare.
+type templateSymbols struct {
+	decls      map[string]bool     // Functions, types, variables and constants
+	methods    map[string]bool     // "Type.Method"
+	imports    map[string]string   // Local name -> import path, plus the allowed packages
+	strategies map[string]bool     // Built-in strategy keys, which mods cannot take over
+	restricted map[string]bool     // Engine names mods may not reference (see restrictedNames)
+	types      map[string]ast.Expr // Type declarations, to tell struct literals from the rest
+}
+
+func packageName(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// receiverType returns the base type name of a method receiver.
+func receiverType(recv *ast.FieldList) string {
+	if recv == nil || len(recv.List) == 0 {
+		return ""
+	}
+	expr := recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.IndexExpr:
+		if id, ok := t.X.(*ast.Ident); ok {
+			return id.Name
+		}
+	case *ast.IndexListExpr:
+		if id, ok := t.X.(*ast.Ident); ok {
+			return id.Name
+		}
+	}
+	return ""
+}
+
+// loadTemplateSymbols collects the top-level declarations and imports of main.go.
+func loadTemplateSymbols(templateCode string) (*templateSymbols, error) {
+	fset := token.NewFileSet()
+	tmpl, err := parser.ParseFile(fset, "main.go", templateCode, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse main.go template: %w", err)
+	}
+	syms := &templateSymbols{
+		decls:      make(map[string]bool),
+		methods:    make(map[string]bool),
+		imports:    make(map[string]string),
+		strategies: make(map[string]bool),
+		types:      make(map[string]ast.Expr),
+	}
+	for _, spec := range tmpl.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := packageName(path)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		syms.imports[name] = path
+	}
+	for path := range allowedModPackages {
+		if _, ok := syms.imports[packageName(path)]; !ok {
+			syms.imports[packageName(path)] = path
+		}
+	}
+	for _, decl := range tmpl.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if recv := receiverType(d.Recv); recv != "" {
+				syms.methods[recv+"."+d.Name.Name] = true
+			} else {
+				syms.decls[d.Name.Name] = true
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					syms.decls[s.Name.Name] = true
+					syms.types[s.Name.Name] = s.Type
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						syms.decls[name.Name] = true
+					}
+				}
+			}
+		}
+	}
+
+	// Strategy keys are the string keys of the managedStrategies table and of any
+	// map[string]StrategyFunction literal.
+	ast.Inspect(tmpl, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ValueSpec:
+			for i, name := range n.Names {
+				if name.Name == "managedStrategies" && i < len(n.Values) {
+					if lit, ok := n.Values[i].(*ast.CompositeLit); ok {
+						addStrategyKeys(syms.strategies, lit)
+					}
+				}
+			}
+		case *ast.CompositeLit:
+			if m, ok := n.Type.(*ast.MapType); ok {
+				if v, ok := m.Value.(*ast.Ident); ok && v.Name == "StrategyFunction" {
+					addStrategyKeys(syms.strategies, n)
+				}
+			}
+		}
+		return true
+	})
+	delete(syms.strategies, "user_mod")
+	syms.restricted = restrictedNames(tmpl, syms.imports)
+	return syms, nil
+}
+
+// modRegistryNames are the engine's mod registry, which mods may not reference so that
+// one mod cannot replace or unregister another.
+var modRegistryNames = []string{"userMods", "registerUserMod"}
+
+// restrictedNames returns the top-level names of the template that mods may not
+// reference: the mod registry, every declaration that uses syscall/js, and every
+// declaration that refers to one of those, repeated until nothing changes. That takes in the page and network
+// helpers (fetchJSON, awaitPromise, logMessage, the update and plot functions), the
+// connectors and BotState itself, whose config holds the API keys. A type is restricted
+// when any of its methods is, since a value of it would hand the method to the mod.
+func restrictedNames(tmpl *ast.File, imports map[string]string) map[string]bool {
+	jsName := ""
+	for name, path := range imports {
+		if path == "syscall/js" {
+			jsName = name
+		}
+	}
+	// refs maps each top-level name to the top-level names its declarations mention.
+	refs := make(map[string]map[string]bool)
+	collect := func(owner string, node ast.Node) {
+		if refs[owner] == nil {
+			refs[owner] = make(map[string]bool)
+		}
+		ast.Inspect(node, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			if id.Obj == nil && id.Name == jsName {
+				refs[owner][id.Name] = true
+			} else if id.Obj != nil && tmpl.Scope.Lookup(id.Name) == id.Obj {
+				refs[owner][id.Name] = true
+			}
+			return true
+		})
+	}
+	for _, decl := range tmpl.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if recv := receiverType(d.Recv); recv != "" {
+				collect(recv, d)
+			} else {
+				collect(d.Name.Name, d)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					collect(s.Name.Name, s)
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						collect(name.Name, s)
+					}
+				}
+			}
+		}
+	}
+
+	restricted := map[string]bool{}
+	for _, name := range modRegistryNames {
+		restricted[name] = true
+	}
+	if jsName != "" {
+		restricted[jsName] = true
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, uses := range refs {
+			if restricted[name] {
+				continue
+			}
+			for use := range uses {
+				if restricted[use] {
+					restricted[name], changed = true, true
+					break
+				}
+			}
+		}
+	}
+	delete(restricted, jsName)
+	return restricted
+}
+
+func addStrategyKeys(keys map[string]bool, lit *ast.CompositeLit) {
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if key, ok := kv.Key.(*ast.BasicLit); ok && key.Kind == token.STRING {
+			if k, err := strconv.Unquote(key.Value); err == nil {
+				keys[k] = true
+			}
+		}
+	}
+}
+
+// isEntryPointSignature reports whether fn is func(StrategyView) Signal.
+func isEntryPointSignature(fn *ast.FuncType) bool {
+	if fn.TypeParams != nil || fn.Params == nil || fn.Results == nil {
+		return false
+	}
+	if len(fn.Params.List) != 1 || len(fn.Params.List[0].Names) > 1 {
+		return false
+	}
+	if len(fn.Results.List) != 1 || len(fn.Results.List[0].Names) > 1 {
+		return false
+	}
+	param, ok := fn.Params.List[0].Type.(*ast.Ident)
+	if !ok || param.Name != "StrategyView" {
+		return false
+	}
+	result, ok := fn.Results.List[0].Type.(*ast.Ident)
+	return ok && result.Name == "Signal"
+}
+
+// underlying follows a type name declared by the mod or the engine to its type literal.
+// It returns nil for predeclared, package and generic types, whose literals are not
+// known to be structs.
+func (syms *templateSymbols) underlying(typ ast.Expr) ast.Expr {
+	for depth := 0; depth < 16; depth++ { // Bounds invalid cycles such as type A B; type B A
+		switch t := typ.(type) {
+		case *ast.ParenExpr:
+			typ = t.X
+		case *ast.Ident:
+			if t.Obj != nil {
+				spec, ok := t.Obj.Decl.(*ast.TypeSpec)
+				if !ok || spec.TypeParams != nil {
+					return nil
+				}
+				typ = spec.Type
+			} else if engine, ok := syms.types[t.Name]; ok {
+				typ = engine
+			} else {
+				return nil
+			}
+		default:
+			return typ
+		}
+	}
+	return nil
+}
+
+// botStateParam returns the BotState in a func(*BotState) entry point, the signature
+// mods had before they were given a StrategyView, or nil if fn is not one.
+func botStateParam(fn *ast.FuncType) *ast.Ident {
+	if fn.TypeParams != nil || fn.Params == nil || len(fn.Params.List) != 1 {
+		return nil
+	}
+	star, ok := fn.Params.List[0].Type.(*ast.StarExpr)
+	if !ok {
+		return nil
+	}
+	if param, ok := star.X.(*ast.Ident); ok && param.Name == "BotState" {
+		return param
+	}
+	return nil
+}
+
+// parsedMod is a mod that passed validation, ready to be written out as a build file.
+type parsedMod struct {
+	spec      ModSpec
+	imports   []string     // Allowed packages the mod references, as import paths
+	entryRefs []int        // Byte offsets of strategyUserMod references in spec.Code
+	declared  []Diagnostic // Top-level names, positioned, to check against other mods
+}
+
+// parseMod validates a mod against the template: it must parse, must not import
+// anything, must declare strategyUserMod with the strategy signature, must not
+// redeclare engine symbols and may only use the allowed packages and the engine names
+// that stay clear of the page and the network. Positions in the returned diagnostics
+// are relative to the mod as the user wrote it.
+func parseMod(syms *templateSymbols, spec ModSpec) (*parsedMod, []Diagnostic) {
+	// The "package" line shifts positions by one, so report lines relative to the mod.
+	const prefix = "package main\n"
+	fset := token.NewFileSet()
+	mod, err := parser.ParseFile(fset, "mod.go", prefix+spec.Code, parser.AllErrors)
+	var diags []Diagnostic
+	position := func(pos token.Pos, msg string) Diagnostic {
+		p := fset.Position(pos)
+		return Diagnostic{Mod: spec.Key, Line: p.Line - 1, Column: p.Column, Message: msg}
+	}
+	at := func(pos token.Pos, format string, args ...interface{}) {
+		diags = append(diags, position(pos, fmt.Sprintf(format, args...)))
+	}
+	if err != nil {
+		if list, ok := err.(scanner.ErrorList); ok {
+			for _, e := range list {
+				diags = append(diags, Diagnostic{Mod: spec.Key, Line: e.Pos.Line - 1, Column: e.Pos.Column, Message: e.Msg})
+			}
+			return nil, diags
+		}
+		return nil, []Diagnostic{{Mod: spec.Key, Message: err.Error()}}
+	}
+
+	for _, imp := range mod.Imports {
+		at(imp.Pos(), "mods cannot declare imports; the allowed packages (%s) are imported automatically", allowedModList())
+	}
+
+	parsed := &parsedMod{spec: spec}
+	var entry *ast.FuncDecl
+	var legacy *ast.Ident // BotState in an old-style entry point, already reported
+	declare := func(name *ast.Ident, kind string) {
+		switch {
+		case name.Name == "_":
+		case reservedModNames[name.Name]:
+			at(name.Pos(), "mods cannot declare %s %s", kind, name.Name)
+		case syms.decls[name.Name]:
+			at(name.Pos(), "%s %s is already declared by the engine", kind, name.Name)
+		case syms.imports[name.Name] != "":
+			at(name.Pos(), "%s %s shadows the %q package", kind, name.Name, syms.imports[name.Name])
+		default:
+			parsed.declared = append(parsed.declared, position(name.Pos(), name.Name))
+		}
+	}
+	for _, decl := range mod.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if recv := receiverType(d.Recv); recv != "" {
+				if syms.methods[recv+"."+d.Name.Name] {
+					at(d.Name.Pos(), "method %s.%s is already declared by the engine", recv, d.Name.Name)
+				} else {
+					parsed.declared = append(parsed.declared, position(d.Name.Pos(), recv+"."+d.Name.Name))
+				}
+				continue
+			}
+			if d.Name.Name == modEntryPoint {
+				if entry != nil {
+					at(d.Name.Pos(), "%s is declared more than once", modEntryPoint)
+				} else if legacy = botStateParam(d.Type); legacy != nil {
+					at(d.Name.Pos(), "%s no longer receives *BotState; change it to func(s StrategyView) Signal and read "+
+						"s.Prices, s.Params[...], s.Book, s.BookReady and s.LastSignal instead of bs.prices, "+
+						"bs.config.StrategyParams[...], bs.book, bs.bookReady and bs.lastPosition", modEntryPoint)
+				} else if !isEntryPointSignature(d.Type) {
+					at(d.Name.Pos(), "%s must have the signature func(s StrategyView) Signal", modEntryPoint)
+				}
+				if entry == nil {
+					entry = d
+				}
+				continue
+			}
+			declare(d.Name, "func")
+		case *ast.GenDecl:
+			for _, ds := range d.Specs {
+				switch s := ds.(type) {
+				case *ast.TypeSpec:
+					declare(s.Name, "type")
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						declare(name, d.Tok.String())
+					}
+				}
+			}
+		}
+	}
+	if entry == nil {
+		diags = append(diags, Diagnostic{Mod: spec.Key, Line: 1, Message: fmt.Sprintf("mod must declare func %s(s StrategyView) Signal", modEntryPoint)})
+	}
+
+	// A selector on an unresolved identifier is a package reference, since the mod
+	// has no imports of its own and declares no top-level names that shadow packages.
+	// Any other unresolved identifier is an engine or predeclared name, except for the
+	// package clause, field and method names after a dot and field names in struct
+	// literals. Keys in map, slice and array literals are expressions, so a literal's
+	// keys are only skipped when its type is known to be a struct.
+	used := make(map[string]bool)
+	names := map[*ast.Ident]bool{mod.Name: true} // Identifiers that are not references
+	if legacy != nil {
+		names[legacy] = true
+	}
+	elided := make(map[*ast.CompositeLit]ast.Expr) // Element literals -> the type they omit
+	elide := func(e, typ ast.Expr) {
+		if star, ok := typ.(*ast.StarExpr); ok {
+			typ = star.X
+		}
+		if lit, ok := e.(*ast.CompositeLit); ok && lit.Type == nil {
+			elided[lit] = typ
+		}
+	}
+	ast.Inspect(mod, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.CompositeLit); ok {
+			typ := lit.Type
+			if typ == nil {
+				typ = elided[lit]
+			}
+			switch t := syms.underlying(typ).(type) {
+			case *ast.StructType:
+				for _, elt := range lit.Elts {
+					if kv, ok := elt.(*ast.KeyValueExpr); ok {
+						if key, ok := kv.Key.(*ast.Ident); ok {
+							names[key] = true
+						}
+					}
+				}
+			case *ast.ArrayType:
+				for _, elt := range lit.Elts {
+					if kv, ok := elt.(*ast.KeyValueExpr); ok {
+						elt = kv.Value
+					}
+					elide(elt, t.Elt)
+				}
+			case *ast.MapType:
+				for _, elt := range lit.Elts {
+					if kv, ok := elt.(*ast.KeyValueExpr); ok {
+						elide(kv.Key, t.Key)
+						elide(kv.Value, t.Value)
+					}
+				}
+			}
+		}
+		if id, ok := n.(*ast.Ident); ok {
+			switch {
+			case entry != nil && id.Obj == entry.Name.Obj:
+				parsed.entryRefs = append(parsed.entryRefs, fset.Position(id.Pos()).Offset-len(prefix))
+			case id.Obj == nil && !names[id] && syms.restricted[id.Name]:
+				at(id.Pos(), "%s is part of the engine and not available to mods", id.Name)
+			}
+			return true
+		}
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		names[sel.Sel] = true
+		pkg, ok := sel.X.(*ast.Ident)
+		if !ok || pkg.Obj != nil {
+			return true
+		}
+		path, isImport := syms.imports[pkg.Name]
+		if !isImport {
+			return true
+		}
+		if !allowedModPackages[path] {
+			at(sel.Pos(), "package %q is not available to mods", path)
+			return true
+		}
+		used[path] = true
+		return true
+	})
+
+	if len(diags) > 0 {
+		return nil, diags
+	}
+	for path := range used {
+		parsed.imports = append(parsed.imports, path)
+	}
+	sort.Strings(parsed.imports)
+	return parsed, nil
+}
+
+// checkModSpec validates the metadata of a mod: its key and its parameter schema.
+func checkModSpec(syms *templateSymbols, spec ModSpec) []Diagnostic {
+	var diags []Diagnostic
+	fail := func(format string, args ...interface{}) {
+		diags = append(diags, Diagnostic{Mod: spec.Key, Message: fmt.Sprintf(format, args...)})
+	}
+	switch {
+	case !modKeyPattern.MatchString(spec.Key):
+		fail("strategy key %q must be lower case letters, digits and underscores, starting with a letter", spec.Key)
+	case syms.strategies[spec.Key]:
+		fail("strategy key %q is already used by a built-in strategy", spec.Key)
+	}
+	if strings.TrimSpace(spec.Code) == "" {
+		fail("mod has no code")
+	}
+	if len(spec.Code) > maxModCode {
+		fail("mod code is %d bytes; mods can be at most %d", len(spec.Code), maxModCode)
+	}
+	if len(spec.Params) > maxModParams {
+		fail("mods can have at most %d parameters", maxModParams)
+	}
+	seen := make(map[string]bool)
+	for _, p := range spec.Params {
+		switch {
+		case !modKeyPattern.MatchString(p.Key):
+			fail("parameter key %q must be lower case letters, digits and underscores, starting with a letter", p.Key)
+		case seen[p.Key]:
+			fail("parameter %q is declared more than once", p.Key)
+		case p.Min != nil && p.Max != nil && *p.Min > *p.Max:
+			fail("parameter %q has min greater than max", p.Key)
+		}
+		seen[p.Key] = true
+	}
+	return diags
+}
+
+// parseMods validates every mod in a request, including that mods do not collide with
+// each other on strategy keys or top-level names.
+func parseMods(syms *templateSymbols, specs []ModSpec) ([]*parsedMod, error) {
+	if len(specs) == 0 {
+		return nil, &ModError{Diagnostics: []Diagnostic{{Message: "no mods to build"}}}
+	}
+	if len(specs) > maxModsPerBuild {
+		return nil, &ModError{Diagnostics: []Diagnostic{{Message: fmt.Sprintf("at most %d mods can be built together", maxModsPerBuild)}}}
+	}
+	var diags []Diagnostic
+	var mods []*parsedMod
+	keys := make(map[string]bool)
+	owners := make(map[string]string) // Top-level name -> key of the mod declaring it
+	for _, spec := range specs {
+		if spec.Name == "" {
+			spec.Name = spec.Key
+		}
+		if keys[spec.Key] {
+			diags = append(diags, Diagnostic{Mod: spec.Key, Message: fmt.Sprintf("strategy key %q is used by more than one mod", spec.Key)})
+			continue
+		}
+		keys[spec.Key] = true
+		specDiags := checkModSpec(syms, spec)
+		mod, modDiags := parseMod(syms, spec)
+		modDiags = append(specDiags, modDiags...)
+		sort.SliceStable(modDiags, func(i, j int) bool {
+			if modDiags[i].Line != modDiags[j].Line {
+				return modDiags[i].Line < modDiags[j].Line
+			}
+			return modDiags[i].Column < modDiags[j].Column
+		})
+		diags = append(diags, modDiags...)
+		if mod == nil {
+			continue
+		}
+		for _, d := range mod.declared {
+			if owner, taken := owners[d.Message]; taken {
+				d.Message = fmt.Sprintf("%s is already declared by mod %s", d.Message, owner)
+				diags = append(diags, d)
+				continue
+			}
+			owners[d.Message] = spec.Key
+		}
+		mods = append(mods, mod)
+	}
+	if len(diags) > 0 {
+		return nil, &ModError{Diagnostics: diags}
+	}
+	return mods, nil
+}
+
+func allowedModList() string {
+	paths := make([]string, 0, len(allowedModPackages))
+	for path := range allowedModPackages {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return strings.Join(paths, ", ")
+}
+
+// source renders the build file for the mod, with its entry point renamed to entry, and
+// returns the number of lines that precede the user's code so compiler positions can be
+// mapped back to the editor.
+func (m *parsedMod) source(entry string) (string, int, error) {
+	params := m.spec.Params
+	if params == nil {
+		params = []ModParam{}
+	}
+	schema, err := json.Marshal(params)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var b strings.Builder
+	b.WriteString("// Code generated by the mod compile server. DO NOT EDIT.\n\npackage main\n\n")
+	if len(m.imports) > 0 {
+		b.WriteString("import (\n")
+		for _, path := range m.imports {
+			fmt.Fprintf(&b, "\t%q\n", path)
+		}
+		b.WriteString(")\n\n")
+	}
+	offset := strings.Count(b.String(), "\n")
+	code := m.spec.Code
+	for i := len(m.entryRefs) - 1; i >= 0; i-- {
+		ref := m.entryRefs[i]
+		code = code[:ref] + entry + code[ref+len(modEntryPoint):]
+	}
+	b.WriteString(code)
+	fmt.Fprintf(&b, "\n\nfunc init() {\n\tregisterUserMod(UserMod{Key: %q, Name: %q, Description: %q, Params: []byte(%q), Strategy: %s})\n}\n",
+		m.spec.Key, m.spec.Name, m.spec.Description, schema, entry)
+	return b.String(), offset, nil
+}
+
+// modFile maps a generated build file back to the mod it was rendered from.
+type modFile struct {
+	key    string
+	offset int    // Generated lines before the user's code
+	entry  string // Renamed entry point, reported to the user as strategyUserMod
+}
+
+// compilerMessage matches one error line from the go tool, e.g. "./mod_rsi.go:12:5: undefined: x".
+var compilerMessage = regexp.MustCompile(`^(?:vet: )?(?:\./)?(\w+\.go):(\d+)(?::(\d+))?: (.*)$`)
+
+// compilerDiagnostics turns go build or go vet output into diagnostics of the given
+// severity. Positions in mod files are shifted back by the generated header.
+func compilerDiagnostics(output string, files map[string]modFile, severity string) []Diagnostic {
+	var diags []Diagnostic
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "\t") && len(diags) > 0 {
+			diags[len(diags)-1].Message += "\n" + strings.TrimSpace(line)
+			continue
+		}
+		m := compilerMessage.FindStringSubmatch(line)
+		if m == nil {
+			diags = append(diags, Diagnostic{Severity: severity, Message: line})
+			continue
+		}
+		lineNo, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		file, ok := files[m[1]]
+		if !ok {
+			diags = append(diags, Diagnostic{File: m[1], Line: lineNo, Column: col, Severity: severity, Message: m[4]})
+			continue
+		}
+		msg := strings.Replace(m[4], file.entry, modEntryPoint, -1)
+		diags = append(diags, Diagnostic{Mod: file.key, File: m[1], Line: lineNo - file.offset, Column: col, Severity: severity, Message: msg})
+	}
+	return diags
+}
+
+// Build targets: modules are built for the browser, mod tests natively for the server.
+var (
+	wasmTarget   = []string{"GOOS=js", "GOARCH=wasm"}
+	nativeTarget = []string{"GOOS=" + runtime.GOOS, "GOARCH=" + runtime.GOARCH}
+)
+
+// limitedCommand prepares name to run under prlimit CPU and address-space caps where
+// prlimit is available (Linux), and unrestricted elsewhere.
+func limitedCommand(ctx context.Context, cpuSeconds int, memory int64, name string, args ...string) *exec.Cmd {
+	if prlimit, err := exec.LookPath("prlimit"); err == nil && runtime.GOOS == "linux" {
+		args = append([]string{fmt.Sprintf("--cpu=%d", cpuSeconds), fmt.Sprintf("--as=%d", memory), "--", name}, args...)
+		name = prlimit
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = 5 * time.Second // Don't hang on pipes held open by a killed process
+	return cmd
+}
+
+// sandboxedGo runs a go subcommand in buildDir for target and returns its stderr. The
+// go tool runs with a deadline, a minimal environment that has no credentials and no
+// module proxy, and on Linux under prlimit CPU and memory caps. Cancelling parent kills
+// the go tool.
+func sandboxedGo(parent context.Context, buildDir string, target []string, goArgs ...string) (string, error) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		return "", fmt.Errorf("go toolchain not found: %w", err)
+	}
+	cacheDir := filepath.Join(os.TempDir(), "ganymede-gocache")
+	env := []string{
+		"PATH=" + filepath.Dir(goBin),
+		"HOME=" + buildDir,
+		"GOPATH=" + filepath.Join(buildDir, "gopath"),
+		"GOCACHE=" + cacheDir,
+		"CGO_ENABLED=0",
+		"GOPROXY=off",
+		"GOSUMDB=off",
+		"GOFLAGS=-mod=mod",
+		"GOTOOLCHAIN=local",
+		"GOMAXPROCS=" + buildMaxProcs,
+		"GOMEMLIMIT=" + buildMemLimit,
+	}
+	env = append(env, target...)
+
+	ctx, cancel := context.WithTimeout(parent, buildTimeout)
+	defer cancel()
+	cmd := limitedCommand(ctx, buildCPUSeconds, buildMemory, goBin, goArgs...)
+	cmd.Dir = buildDir
+	cmd.Env = env
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if parent.Err() != nil {
+		return stderr.String(), parent.Err()
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return stderr.String(), fmt.Errorf("go %s exceeded the %s time limit", goArgs[0], buildTimeout)
+	}
+	return stderr.String(), err
+}
+
+// sandboxedBuild compiles the files in buildDir for target to outPath.
+func sandboxedBuild(ctx context.Context, buildDir string, target []string, files []string, outPath string) (string, error) {
+	// -trimpath keeps the temp build directory out of the binary, so rebuilding the same
+	// mods against the same template produces the same module.
+	return sandboxedGo(ctx, buildDir, target, append([]string{"build", "-p", "1", "-trimpath", "-buildvcs=false", "-o", outPath}, files...)...)
+}
+
+// sandboxedVet runs go vet over the files in buildDir and returns its warnings for the
+// mod files. Findings in the engine itself are not the mod author's concern.
+func sandboxedVet(ctx context.Context, buildDir string, files []string, modFiles map[string]modFile) []Diagnostic {
+	output, err := sandboxedGo(ctx, buildDir, wasmTarget, append([]string{"vet"}, files...)...)
+	if err == nil || ctx.Err() != nil {
+		return nil
+	}
+	var warnings []Diagnostic
+	for _, d := range compilerDiagnostics(output, modFiles, SeverityWarning) {
+		if d.Mod != "" {
+			warnings = append(warnings, d)
+		}
+	}
+	if len(warnings) == 0 && strings.TrimSpace(output) != "" {
+		log.Printf("go vet reported nothing for the mods but failed: %v\n%s", err, output)
+	}
+	return warnings
+}
+
+func readTemplate() ([]byte, error) {
+	templateBytes, err := ioutil.ReadFile("main.go")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read main.go template: %w", err)
+	}
+	return templateBytes, nil
+}
+
+// buildMods validates the mods, writes the untouched main.go template and one generated
+// file per mod to a temp directory, compiles them to outPath and vets them. Validation
+// and compiler errors are returned as a *ModError; vet findings are returned as warnings
+// alongside a successful build.
+func buildMods(ctx context.Context, templateBytes []byte, specs []ModSpec, outPath string) ([]Diagnostic, error) {
+	// 1. Create a temporary directory for the build to keep things clean
+	buildDir, err := ioutil.TempDir("", "ganymede-build-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp build directory: %w", err)
+	}
+	defer os.RemoveAll(buildDir) // Clean up afterward
+
+	// 2. Check the mods against the template and write them side by side
+	buildFiles, files, err := writeModBuild(buildDir, templateBytes, specs)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Compile, mapping compiler errors back to the mods
+	output, err := sandboxedBuild(ctx, buildDir, wasmTarget, buildFiles, outPath)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, compileError(output, err, files)
+	}
+
+	// 4. Vet the mods that compiled
+	return sandboxedVet(ctx, buildDir, buildFiles, files), ctx.Err()
+}
+
+// writeModBuild validates the mods against the template, then writes the template as
+// main.go and one generated file per mod into buildDir. It returns the files to build and
+// the mapping from mod files back to the mods.
+func writeModBuild(buildDir string, templateBytes []byte, specs []ModSpec) ([]string, map[string]modFile, error) {
+	syms, err := loadTemplateSymbols(string(templateBytes))
+	if err != nil {
+		return nil, nil, err
+	}
+	mods, err := parseMods(syms, specs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(buildDir, "main.go"), templateBytes, 0644); err != nil {
+		return nil, nil, fmt.Errorf("failed to write temp go file: %w", err)
+	}
+	buildFiles := []string{"main.go"}
+	files := make(map[string]modFile)
+	for i, mod := range mods {
+		name := modFileName(mod.spec.Key)
+		entry := entryPointName(i)
+		source, offset, err := mod.source(entry)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to render mod %s: %w", mod.spec.Key, err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(buildDir, name), []byte(source), 0644); err != nil {
+			return nil, nil, fmt.Errorf("failed to write temp go file: %w", err)
+		}
+		buildFiles = append(buildFiles, name)
+		files[name] = modFile{key: mod.spec.Key, offset: offset, entry: entry}
+	}
+	return buildFiles, files, nil
+}
+
+// compileError turns a failed go build into a *ModError.
+func compileError(output string, err error, files map[string]modFile) error {
+	diags := compilerDiagnostics(output, files, SeverityError)
+	if len(diags) == 0 {
+		diags = []Diagnostic{{Severity: SeverityError, Message: err.Error()}}
+	}
+	return &ModError{Diagnostics: diags}
+}
+
+// Compiled modules are kept in artifactDir as mod_<hash>.wasm, where hash covers the
+// template and the mods, next to a mod_<hash>.json sidecar describing the build. A module
+// is pruned once it has gone unused for artifactMaxAge or more than artifactMaxCount
+// newer modules exist. Serving a cached module counts as a use.
+const (
+	artifactDir        = "public"
+	artifactMaxAge     = 7 * 24 * time.Hour
+	artifactMaxCount   = 50
+	artifactGCInterval = time.Hour
+)
+
+// ModArtifact describes a compiled module, as stored in its sidecar and listed by /mods.
+type ModArtifact struct {
+	Hash     string        `json:"hash"`
+	URL      string        `json:"url"`
+	BuiltAt  time.Time     `json:"builtAt"`
+	LastUsed time.Time     `json:"lastUsed"`
+	Size     int64         `json:"size"`
+	Mods     []ArtifactMod `json:"mods"`
+	Warnings []Diagnostic  `json:"warnings,omitempty"` // go vet findings from the build
+}
+
+// ArtifactMod names one of the strategies compiled into a module.
+type ArtifactMod struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+// artifactMu serialises publishing, reusing and pruning artifacts so a module is never
+// deleted between being found in the cache and being handed out.
+var artifactMu sync.Mutex
+
+// sourceHash identifies a build by the template and the mods compiled into it.
+func sourceHash(templateBytes []byte, specs []ModSpec) (string, error) {
+	modsJSON, err := json.Marshal(specs)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write(templateBytes)
+	h.Write([]byte{0})
+	h.Write(modsJSON)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func artifactPaths(hash string) (wasmPath, metaPath string) {
+	base := filepath.Join(artifactDir, "mod_"+hash)
+	return base + ".wasm", base + ".json"
+}
+
+// cachedArtifact returns an existing module for hash and marks it as used.
+func cachedArtifact(hash string) (*ModArtifact, bool) {
+	artifactMu.Lock()
+	defer artifactMu.Unlock()
+	wasmPath, metaPath := artifactPaths(hash)
+	metaJSON, err := ioutil.ReadFile(metaPath)
+	if err != nil {
+		return nil, false
+	}
+	var meta ModArtifact
+	if err := json.Unmarshal(metaJSON, &meta); err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	if err := os.Chtimes(wasmPath, now, now); err != nil {
+		return nil, false
+	}
+	return &meta, true
+}
+
+// publishArtifact moves a finished build into place and writes its sidecar.
+func publishArtifact(hash, builtPath string, specs []ModSpec, warnings []Diagnostic) (string, error) {
+	artifactMu.Lock()
+	defer artifactMu.Unlock()
+	wasmPath, metaPath := artifactPaths(hash)
+	info, err := os.Stat(builtPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat build output: %w", err)
+	}
+	now := time.Now().UTC()
+	meta := ModArtifact{Hash: hash, URL: "/" + filepath.ToSlash(wasmPath), BuiltAt: now, LastUsed: now, Size: info.Size(), Warnings: warnings}
+	for _, spec := range specs {
+		meta.Mods = append(meta.Mods, ArtifactMod{Key: spec.Key, Name: spec.Name})
+	}
+	metaJSON, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(builtPath, wasmPath); err != nil {
+		return "", fmt.Errorf("failed to publish module: %w", err)
+	}
+	if err := ioutil.WriteFile(metaPath+".tmp", metaJSON, 0644); err != nil {
+		return "", fmt.Errorf("failed to write module metadata: %w", err)
+	}
+	if err := os.Rename(metaPath+".tmp", metaPath); err != nil {
+		return "", fmt.Errorf("failed to write module metadata: %w", err)
+	}
+	return meta.URL, nil
+}
+
+// listArtifacts returns the compiled modules, most recently used first. Modules from
+// before content hashing have no sidecar and are listed without a hash.
+func listArtifacts() ([]ModArtifact, error) {
+	paths, err := filepath.Glob(filepath.Join(artifactDir, "mod_*.wasm"))
+	if err != nil {
+		return nil, err
+	}
+	artifacts := make([]ModArtifact, 0, len(paths))
+	for _, wasmPath := range paths {
+		info, err := os.Stat(wasmPath)
+		if err != nil {
+			continue
+		}
+		a := ModArtifact{URL: "/" + filepath.ToSlash(wasmPath), BuiltAt: info.ModTime().UTC()}
+		if metaJSON, err := ioutil.ReadFile(strings.TrimSuffix(wasmPath, ".wasm") + ".json"); err == nil {
+			json.Unmarshal(metaJSON, &a)
+		}
+		a.LastUsed = info.ModTime().UTC()
+		a.Size = info.Size()
+		artifacts = append(artifacts, a)
+	}
+	sort.Slice(artifacts, func(i, j int) bool { return artifacts[i].LastUsed.After(artifacts[j].LastUsed) })
+	return artifacts, nil
+}
+
+// pruneArtifacts deletes modules that fall outside the retention policy.
+func pruneArtifacts() {
+	artifactMu.Lock()
+	defer artifactMu.Unlock()
+	artifacts, err := listArtifacts()
+	if err != nil {
+		log.Printf("Artifact GC failed: %v", err)
+		return
+	}
+	removed := 0
+	for i, a := range artifacts {
+		if i < artifactMaxCount && time.Since(a.LastUsed) <= artifactMaxAge {
+			continue
+		}
+		wasmPath := filepath.FromSlash(strings.TrimPrefix(a.URL, "/"))
+		if err := os.Remove(wasmPath); err != nil {
+			log.Printf("Artifact GC: %v", err)
+			continue
+		}
+		os.Remove(strings.TrimSuffix(wasmPath, ".wasm") + ".json")
+		removed++
+	}
+	// Output left behind by a build that was interrupted mid-way.
+	if leftovers, err := filepath.Glob(filepath.Join(artifactDir, "build-*.wasm.tmp")); err == nil {
+		for _, path := range leftovers {
+			if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > 2*buildTimeout {
+				os.Remove(path)
+			}
+		}
+	}
+	if removed > 0 {
+		log.Printf("Artifact GC removed %d module(s).", removed)
+	}
+}
+
+// compileAndBuild builds the mods into artifactDir and returns the successful response,
+// with the module's URL, source hash and any vet warnings. A module already built from
+// the same template and mods is reused.
+func compileAndBuild(ctx context.Context, specs []ModSpec) (*CompileResponse, error) {
+	templateBytes, err := readTemplate()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := sourceHash(templateBytes, specs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash mods: %w", err)
+	}
+	if meta, ok := cachedArtifact(hash); ok {
+		return &CompileResponse{Success: true, URL: meta.URL, Hash: hash, Cached: true, Diagnostics: meta.Warnings}, nil
+	}
+
+	// Build next to the final path so publishing is an atomic rename, and so concurrent
+	// builds of the same mods cannot see each other's partial output.
+	tmpFile, err := ioutil.TempFile(artifactDir, "build-*.wasm.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create build output: %w", err)
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+	absOutPath, err := filepath.Abs(tmpFile.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve output path: %w", err)
+	}
+
+	warnings, err := buildMods(ctx, templateBytes, specs, absOutPath)
+	if err != nil {
+		return nil, err
+	}
+	url, err := publishArtifact(hash, tmpFile.Name(), specs, warnings)
+	if err != nil {
+		return nil, err
+	}
+	pruneArtifacts()
+	return &CompileResponse{Success: true, URL: url, Hash: hash, Diagnostics: warnings}, nil
+}
+
+// validateCode checks if the mods compile without creating a permanent file, and
+// returns their vet warnings.
+func validateCode(ctx context.Context, specs []ModSpec) ([]Diagnostic, error) {
+	templateBytes, err := readTemplate()
+	if err != nil {
+		return nil, err
+	}
+	outDir, err := ioutil.TempDir("", "ganymede-validate-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp validation directory: %w", err)
+	}
+	defer os.RemoveAll(outDir)
+
+	// We compile to a dummy output path within the temp directory.
+	return buildMods(ctx, templateBytes, specs, filepath.Join(outDir, "output.wasm"))
+}
+
+// errorResponse builds the failure response for err, including diagnostics for mod errors.
+func errorResponse(err error) CompileResponse {
+	resp := CompileResponse{Success: false, Error: err.Error()}
+	var modErr *ModError
+	if errors.As(err, &modErr) {
+		resp.Diagnostics = located(modErr.Diagnostics, SeverityError)
+	}
+	return resp
+}
+
+// Mod tests run each mod natively on the server over price series, either built-in
+// scenarios or series sent in the request, and report the signals it emitted with a
+// small backtest. The engine is built for the server with syscall/js replaced by an
+// inert stub, so mods see the same StrategyView and helpers as in the browser.
+const (
+	testTimeout        = 20 * time.Second
+	testCPUSeconds     = 10
+	testMemory         = 2 << 30 // Address-space cap for the test binary, in bytes
+	maxTestSeries      = 8
+	maxTestPoints      = 5000
+	scenarioLength     = 200     // Matches the engine's price window
+	testStartingEquity = 10000.0 // Matches NewBotState
+)
+
+// testScenarios are the built-in price series, run when a request names none.
+var testScenarios = []string{"uptrend", "downtrend", "range", "crash"}
+
+// ModTest is the optional test block of a /test request. Without one, every mod runs
+// over all built-in scenarios with its default parameter values, and the backtest uses
+// the engine's default fees and slippage.
+type ModTest struct {
+	Scenarios []string                      `json:"scenarios,omitempty"`
+	Series    []TestSeries                  `json:"series,omitempty"`
+	Params    map[string]map[string]float64 `json:"params,omitempty"`    // Mod key -> parameter overrides
+	Connector string                        `json:"connector,omitempty"` // Exchange whose fee schedule prices the fills
+	Costs     json.RawMessage               `json:"costs,omitempty"`     // Fee and slippage overrides, as in the bot's config
+}
+
+// TestSeries is a custom price series to run the mods over.
+type TestSeries struct {
+	Name   string    `json:"name"`
+	Prices []float64 `json:"prices"`
+}
+
+// ModTestResult is one mod's run over one series.
+type ModTestResult struct {
+	Mod     string          `json:"mod"`
+	Series  string          `json:"series"`
+	Signals []string        `json:"signals"`         // HOLD, BUY or SELL for each price
+	Error   string          `json:"error,omitempty"` // Set if the mod panicked; signals stop there
+	Summary BacktestSummary `json:"summary"`
+}
+
+// BacktestSummary trades the signals long-only: a BUY while flat puts all equity into the
+// asset and a SELL while long closes the position. Each fill is a market order priced
+// like a paper trade, with slippage against it and the taker fee for the volume so far.
+type BacktestSummary struct {
+	Ticks          int     `json:"ticks"`
+	Buys           int     `json:"buys"`
+	Sells          int     `json:"sells"`
+	Trades         int     `json:"trades"` // Closed round trips
+	Wins           int     `json:"wins"`
+	WinRate        float64 `json:"winRate"` // Percent of trades closed at a profit
+	ReturnPct      float64 `json:"returnPct"`
+	BuyHoldPct     float64 `json:"buyHoldPct"`
+	MaxDrawdownPct float64 `json:"maxDrawdownPct"`
+	FinalEquity    float64 `json:"finalEquity"`
+}
+
+// scenarioPrices generates a built-in scenario. Each scenario uses a fixed seed, so runs
+// are repeatable.
+func scenarioPrices(name string) ([]float64, bool) {
+	var seed int64
+	for _, c := range name {
+		seed = seed*31 + int64(c)
+	}
+	rng := rand.New(rand.NewSource(seed))
+	prices := make([]float64, scenarioLength)
+	price := 100.0
+	for i := range prices {
+		noise := rng.NormFloat64() * 0.005
+		switch name {
+		case "uptrend":
+			price *= 1.003 + noise
+		case "downtrend":
+			price *= 0.997 + noise
+		case "range":
+			price = 100 + 5*math.Sin(float64(i)*2*math.Pi/40) + rng.NormFloat64()*0.5
+		case "crash":
+			switch {
+			case i < 120:
+				price *= 1.001 + noise
+			case i < 130:
+				price *= 0.96 + noise // About -35% over ten ticks
+			default:
+				price *= 1.0015 + noise
+			}
+		default:
+			return nil, false
+		}
+		prices[i] = math.Round(price*100) / 100
+	}
+	return prices, true
+}
+
+// testSeries resolves the series a test runs over.
+func (t *ModTest) testSeries() ([]TestSeries, error) {
+	names := testScenarios
+	var custom []TestSeries
+	if t != nil {
+		custom = t.Series
+		if len(t.Scenarios) > 0 || len(t.Series) > 0 {
+			names = t.Scenarios
+		}
+	}
+	if len(names)+len(custom) > maxTestSeries {
+		return nil, fmt.Errorf("at most %d test series are allowed", maxTestSeries)
+	}
+	var series []TestSeries
+	seen := make(map[string]bool)
+	for _, name := range names {
+		prices, ok := scenarioPrices(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown test scenario %q (available: %s)", name, strings.Join(testScenarios, ", "))
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		series = append(series, TestSeries{Name: name, Prices: prices})
+	}
+	for i, s := range custom {
+		if s.Name == "" {
+			s.Name = fmt.Sprintf("series %d", i+1)
+		}
+		if len(s.Prices) == 0 || len(s.Prices) > maxTestPoints {
+			return nil, fmt.Errorf("test series %q must have between 1 and %d prices", s.Name, maxTestPoints)
+		}
+		for _, p := range s.Prices {
+			if p <= 0 || math.IsInf(p, 0) || math.IsNaN(p) {
+				return nil, fmt.Errorf("test series %q has a price that is not a positive number", s.Name)
+			}
+		}
+		if seen[s.Name] {
+			return nil, fmt.Errorf("test series %q is given more than once", s.Name)
+		}
+		seen[s.Name] = true
+		series = append(series, s)
+	}
+	return series, nil
+}
+
+// jsStubSource stands in for syscall/js in native test builds. Every value is undefined
+// and every call does nothing, which is all the engine's UI and network code needs when
+// it is never started.
+const jsStubSource = `// Code generated by the mod compile server. DO NOT EDIT.
+
+// Package js is an inert stand-in for syscall/js, for running the engine natively.
+package js
+
+type Type int
+
+const (
+	TypeUndefined Type = iota
+	TypeNull
+	TypeBoolean
+	TypeNumber
+	TypeString
+	TypeSymbol
+	TypeObject
+	TypeFunction
+)
+
+func (t Type) String() string { return "undefined" }
+
+type Value struct{}
+
+func Global() Value                 { return Value{} }
+func Undefined() Value              { return Value{} }
+func Null() Value                   { return Value{} }
+func ValueOf(x any) Value           { return Value{} }
+func CopyBytesToGo(dst []byte, src Value) int { return 0 }
+func CopyBytesToJS(dst Value, src []byte) int { return 0 }
+
+func (v Value) Get(p string) Value            { return Value{} }
+func (v Value) Set(p string, x any)           {}
+func (v Value) Delete(p string)               {}
+func (v Value) Index(i int) Value             { return Value{} }
+func (v Value) SetIndex(i int, x any)         {}
+func (v Value) Length() int                   { return 0 }
+func (v Value) Call(m string, args ...any) Value { return Value{} }
+func (v Value) Invoke(args ...any) Value      { return Value{} }
+func (v Value) New(args ...any) Value         { return Value{} }
+func (v Value) Type() Type                    { return TypeUndefined }
+func (v Value) IsUndefined() bool             { return true }
+func (v Value) IsNull() bool                  { return false }
+func (v Value) IsNaN() bool                   { return false }
+func (v Value) Truthy() bool                  { return false }
+func (v Value) Equal(w Value) bool            { return true }
+func (v Value) InstanceOf(t Value) bool       { return false }
+func (v Value) Bool() bool                    { return false }
+func (v Value) Int() int                      { return 0 }
+func (v Value) Float() float64                { return 0 }
+func (v Value) String() string                { return "<undefined>" }
+
+type Func struct{ Value }
+
+func FuncOf(fn func(this Value, args []Value) any) Func { return Func{} }
+func (f Func) Release()                                  {}
+
+type Error struct{ Value }
+
+func (e Error) Error() string { return "JavaScript error" }
+
+type ValueError struct {
+	Method string
+	Type   Type
+}
+
+func (e *ValueError) Error() string { return "syscall/js: call of " + e.Method + " on undefined" }
+`
+
+// testHarnessSource replaces the engine's main in native test builds. It reads the
+// parameters, costs and series from stdin, feeds each series to every registered mod one
+// price at a time as the bot loop does, recording each BUY or SELL as the bot's position,
+// and writes the signals, with the engine's cost model for the connector, to the file
+// named by its argument; stdout is left to the mods.
+const testHarnessSource = `// Code generated by the mod compile server. DO NOT EDIT.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+func main() {
+	var input struct {
+		Params    map[string]map[string]float64 ` + "`json:\"params\"`" + `
+		Connector string                        ` + "`json:\"connector\"`" + `
+		Costs     CostConfig                    ` + "`json:\"costs\"`" + `
+		Series    []struct {
+			Name   string    ` + "`json:\"name\"`" + `
+			Prices []float64 ` + "`json:\"prices\"`" + `
+		} ` + "`json:\"series\"`" + `
+	}
+	if err := json.NewDecoder(os.Stdin).Decode(&input); err != nil {
+		fmt.Fprintln(os.Stderr, "invalid test block:", err)
+		os.Exit(2)
+	}
+
+	type run struct {
+		Mod     string   ` + "`json:\"mod\"`" + `
+		Series  string   ` + "`json:\"series\"`" + `
+		Signals []Signal ` + "`json:\"signals\"`" + `
+		Error   string   ` + "`json:\"error,omitempty\"`" + `
+	}
+	runs := []run{}
+	for _, m := range userMods {
+		for _, series := range input.Series {
+			r := run{Mod: m.Key, Series: series.Name, Signals: []Signal{}}
+			func() {
+				defer func() {
+					if p := recover(); p != nil {
+						r.Error = fmt.Sprintf("panic at tick %d: %v", len(r.Signals), p)
+					}
+				}()
+				bs := NewBotState()
+				bs.config = Config{Symbol: "TEST", Strategy: m.Key, StrategyParams: input.Params[m.Key]}
+				for _, price := range series.Prices {
+					bs.prices = append(bs.prices, price)
+					bs.maintainDataSize(200)
+					sig := m.Strategy(bs.strategyView())
+					r.Signals = append(r.Signals, sig)
+					if sig != HOLD {
+						bs.lastPosition = sig
+					}
+				}
+			}()
+			runs = append(runs, r)
+		}
+	}
+
+	results := struct {
+		Costs CostModel ` + "`json:\"costs\"`" + `
+		Runs  []run     ` + "`json:\"runs\"`" + `
+	}{newCostModel(Config{Connector: input.Connector, Costs: input.Costs}), runs}
+	out, err := os.Create(os.Args[1])
+	if err == nil {
+		err = json.NewEncoder(out).Encode(results)
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to write test results:", err)
+		os.Exit(2)
+	}
+}
+`
+
+// nativeTemplate rewrites the template for a native test build: syscall/js is swapped for
+// the stub at modtest/js and the engine's main is renamed to the blank identifier so the
+// harness can provide its own. Line numbers are unchanged.
+func nativeTemplate(templateBytes []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", templateBytes, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse main.go template: %w", err)
+	}
+	type edit struct {
+		offset, length int
+		text           string
+	}
+	var edits []edit
+	for _, imp := range file.Imports {
+		if imp.Path.Value == `"syscall/js"` {
+			edits = append(edits, edit{fset.Position(imp.Path.Pos()).Offset, len(imp.Path.Value), `"modtest/js"`})
+		}
+	}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "main" {
+			edits = append(edits, edit{fset.Position(fn.Name.Pos()).Offset, len("main"), "_"})
+		}
+	}
+	sort.Slice(edits, func(i, j int) bool { return edits[i].offset > edits[j].offset })
+	src := string(templateBytes)
+	for _, e := range edits {
+		src = src[:e.offset] + e.text + src[e.offset+e.length:]
+	}
+	return []byte(src), nil
 }
 
-// compileAndBuild handles reading the template, injecting user code, and compiling.
-func compileAndBuild(userCode string) (string, error) {
-	// 1. Read the template main.go
-	templateBytes, err := ioutil.ReadFile("main.go")
-	if err != nil {
-		return "", fmt.Errorf("failed to read main.go template: %w", err)
+// signalNames maps the engine's Signal values to their names.
+var signalNames = []string{"HOLD", "BUY", "SELL"}
+
+// testCosts is the engine's CostModel as the test harness reports it, built by the
+// engine's own newCostModel from the test's connector and overrides.
+type testCosts struct {
+	Fees struct {
+		MakerRate   float64
+		TakerRate   float64
+		BNBDiscount float64
+		PayInBNB    bool
+		Tiers       []struct{ MinVolume, MakerRate, TakerRate float64 }
+	}
+	Slippage struct {
+		Model           string
+		FixedBps        float64
+		SpreadBps       float64
+		ImpactBpsPer10k float64
+	}
+}
+
+// takerRate is FeeSchedule.Rate in main.go for a taker fill.
+func (c testCosts) takerRate(volume float64) float64 {
+	rate := c.Fees.TakerRate
+	for _, t := range c.Fees.Tiers {
+		if volume >= t.MinVolume {
+			rate = t.TakerRate
+		}
+	}
+	if c.Fees.PayInBNB {
+		rate *= 1 - c.Fees.BNBDiscount
 	}
-	templateCode := string(templateBytes)
+	return rate
+}
 
-	// 2. Inject user code into the placeholders
-	finalCode := strings.Replace(templateCode, "// [[USER_MOD_STRATEGIES]]", userCode, 1)
-	registration := `"user_mod": strategyUserMod, /* [[USER_MOD_REGISTRATION]] */`
-	finalCode = strings.Replace(finalCode, "/* [[USER_MOD_REGISTRATION]] */", registration, 1)
+// slippage is SlippageModel.Slippage in main.go.
+func (c testCosts) slippage(notional float64) float64 {
+	switch c.Slippage.Model {
+	case "spread":
+		return c.Slippage.SpreadBps / 2 / 10000
+	case "volume":
+		return (c.Slippage.SpreadBps/2 + c.Slippage.ImpactBpsPer10k*notional/10000) / 10000
+	}
+	return c.Slippage.FixedBps / 10000
+}
 
-	// 3. Create a temporary directory for the build to keep things clean
-	buildDir, err := ioutil.TempDir("", "ganymede-build-")
+// backtest summarises the signals emitted over prices, pricing each fill as the paper
+// exchange prices a market order.
+func backtest(prices []float64, signals []string, costs testCosts) BacktestSummary {
+	s := BacktestSummary{Ticks: len(signals), FinalEquity: testStartingEquity}
+	if len(signals) == 0 {
+		return s
+	}
+	cash, qty, cost, volume := testStartingEquity, 0.0, 0.0, 0.0
+	peak := testStartingEquity
+	for i, signal := range signals {
+		price := prices[i]
+		switch signal {
+		case "BUY":
+			s.Buys++
+			if qty == 0 {
+				// Spend all the cash, keeping back the fee on what is bought.
+				notional := cash / (1 + costs.takerRate(volume))
+				fillPrice := price * (1 + costs.slippage(notional))
+				qty, cost, cash = notional/fillPrice, cash, 0
+				volume += notional
+			}
+		case "SELL":
+			s.Sells++
+			if qty > 0 {
+				fillPrice := price * (1 - costs.slippage(qty*price))
+				notional := qty * fillPrice
+				cash, qty = notional*(1-costs.takerRate(volume)), 0
+				volume += notional
+				s.Trades++
+				if cash > cost {
+					s.Wins++
+				}
+			}
+		}
+		equity := cash + qty*price
+		peak = math.Max(peak, equity)
+		s.MaxDrawdownPct = math.Max(s.MaxDrawdownPct, (peak-equity)/peak*100)
+		s.FinalEquity = equity
+	}
+	round := func(v float64) float64 { return math.Round(v*100) / 100 }
+	if s.Trades > 0 {
+		s.WinRate = round(float64(s.Wins) / float64(s.Trades) * 100)
+	}
+	s.ReturnPct = round((s.FinalEquity/testStartingEquity - 1) * 100)
+	s.BuyHoldPct = round((prices[len(signals)-1]/prices[0] - 1) * 100)
+	s.MaxDrawdownPct = round(s.MaxDrawdownPct)
+	s.FinalEquity = round(s.FinalEquity)
+	return s
+}
+
+// testMods builds the mods natively with the test harness and runs them over the test
+// series. Validation and compiler errors are returned as a *ModError, as for a build.
+func testMods(ctx context.Context, specs []ModSpec, test *ModTest) ([]ModTestResult, error) {
+	series, err := test.testSeries()
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp build directory: %w", err)
+		return nil, err
+	}
+	params := make(map[string]map[string]float64)
+	for _, spec := range specs {
+		values := make(map[string]float64)
+		for _, p := range spec.Params {
+			values[p.Key] = p.Value
+		}
+		if test != nil {
+			for k, v := range test.Params[spec.Key] {
+				values[k] = v
+			}
+		}
+		params[spec.Key] = values
+	}
+	harnessInput := map[string]interface{}{"params": params, "series": series}
+	if test != nil {
+		harnessInput["connector"] = test.Connector
+		if len(test.Costs) > 0 {
+			harnessInput["costs"] = test.Costs
+		}
+	}
+	input, err := json.Marshal(harnessInput)
+	if err != nil {
+		return nil, err
 	}
-	defer os.RemoveAll(buildDir) // Clean up afterward
 
-	// 4. Write the new source code to the temp directory
-	if err := ioutil.WriteFile(filepath.Join(buildDir, "main.go"), []byte(finalCode), 0644); err != nil {
-		return "", fmt.Errorf("failed to write temp go file: %w", err)
+	templateBytes, err := readTemplate()
+	if err != nil {
+		return nil, err
+	}
+	nativeBytes, err := nativeTemplate(templateBytes)
+	if err != nil {
+		return nil, err
+	}
+	buildDir, err := ioutil.TempDir("", "ganymede-test-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp test directory: %w", err)
 	}
+	defer os.RemoveAll(buildDir)
 
-	// 5. Compile the code, placing the output in a 'public' directory
-	os.MkdirAll("public", 0755) // Ensure the public directory exists
-	wasmFile := fmt.Sprintf("mod_%d.wasm", time.Now().UnixNano())
-	wasmPath := filepath.Join("public", wasmFile)
+	buildFiles, files, err := writeModBuild(buildDir, templateBytes, specs)
+	if err != nil {
+		return nil, err
+	}
+	generated := map[string]string{
+		"main.go":         string(nativeBytes), // Replaces the template written for WASM
+		"modtest_main.go": testHarnessSource,
+		"js/js.go":        jsStubSource,
+	}
+	if err := os.Mkdir(filepath.Join(buildDir, "js"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create test stub directory: %w", err)
+	}
+	for name, source := range generated {
+		if err := ioutil.WriteFile(filepath.Join(buildDir, name), []byte(source), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write temp go file: %w", err)
+		}
+	}
+	buildFiles = append(buildFiles, "modtest_main.go")
 
-	cmd := exec.Command("go", "build", "-o", wasmPath, "main.go")
-	cmd.Dir = buildDir // Run the command in the temp directory
-	cmd.Env = append(os.Environ(), "GOOS=js", "GOARCH=wasm")
+	// go mod init records the local toolchain's language version, so the native build
+	// accepts exactly what the WASM build does.
+	if output, err := sandboxedGo(ctx, buildDir, nativeTarget, "mod", "init", "modtest"); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to set up test module: %v\n%s", err, output)
+	}
+	binPath := filepath.Join(buildDir, "modtest")
+	output, err := sandboxedBuild(ctx, buildDir, nativeTarget, buildFiles, binPath)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, compileError(output, err, files)
+	}
 
+	// Run the harness with no environment beyond runtime limits.
+	runCtx, cancel := context.WithTimeout(ctx, testTimeout)
+	defer cancel()
+	resultsPath := filepath.Join(buildDir, "results.json")
+	cmd := limitedCommand(runCtx, testCPUSeconds, testMemory, binPath, resultsPath)
+	cmd.Dir = buildDir
+	cmd.Env = []string{"GOMAXPROCS=1", "GOMEMLIMIT=" + buildMemLimit}
+	cmd.Stdin = bytes.NewReader(input)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if runCtx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("mod tests exceeded the %s time limit", testTimeout)
+	}
+	if err != nil && cmd.ProcessState != nil && !cmd.ProcessState.Exited() {
+		return nil, fmt.Errorf("mod tests were killed for exceeding their CPU or memory limit")
+	}
+	if msg := strings.TrimSpace(stderr.String()); err != nil && strings.HasPrefix(msg, "invalid test block:") {
+		return nil, errors.New(msg)
+	}
+	if err != nil {
+		// Keep the runtime's message and drop the goroutine dump after it.
+		detail, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n\n")
+		return nil, fmt.Errorf("mod tests crashed: %v\n%s", err, detail)
+	}
 
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("compilation failed: %s", stderr.String())
+	resultsJSON, err := ioutil.ReadFile(resultsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read test results: %w", err)
+	}
+	var harness struct {
+		Costs testCosts `json:"costs"`
+		Runs  []struct {
+			Mod     string `json:"mod"`
+			Series  string `json:"series"`
+			Signals []int  `json:"signals"`
+			Error   string `json:"error"`
+		} `json:"runs"`
 	}
+	if err := json.Unmarshal(resultsJSON, &harness); err != nil {
+		return nil, fmt.Errorf("failed to read test results: %w", err)
+	}
+	runs := harness.Runs
+	prices := make(map[string][]float64, len(series))
+	for _, s := range series {
+		prices[s.Name] = s.Prices
+	}
+	results := make([]ModTestResult, 0, len(runs))
+	for _, run := range runs {
+		result := ModTestResult{Mod: run.Mod, Series: run.Series, Signals: make([]string, len(run.Signals)), Error: run.Error}
+		for i, signal := range run.Signals {
+			if signal >= 0 && signal < len(signalNames) {
+				result.Signals[i] = signalNames[signal]
+			} else {
+				result.Signals[i] = fmt.Sprintf("SIGNAL(%d)", signal)
+			}
+		}
+		result.Summary = backtest(prices[run.Series], result.Signals, harness.Costs)
+		results = append(results, result)
+	}
+	return results, nil
+}
 
-	// 6. Return the URL to the new WASM file
-	return "/" + wasmPath, nil
+// The mod library keeps every saved version of every mod under modDataDir, one
+// directory per strategy key and one JSON file per version, so any earlier version can
+// be loaded again or rebuilt through CompileRequest.Library.
+const modDataDir = "data/mods"
+
+// StoredMod is one saved version of a mod.
+type StoredMod struct {
+	ModSpec
+	Version int       `json:"version"`
+	SavedAt time.Time `json:"savedAt"`
+	Message string    `json:"message,omitempty"` // Optional note describing the change
 }
 
-// validateCode checks if the user's code compiles without creating a permanent file.
-func validateCode(userCode string) (string, error) {
-	templateBytes, err := ioutil.ReadFile("main.go")
+// LibraryEntry summarises a mod in the library listing.
+type LibraryEntry struct {
+	Key           string    `json:"key"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description,omitempty"`
+	LatestVersion int       `json:"latestVersion"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// ModVersion summarises one version in a mod's history.
+type ModVersion struct {
+	Version int       `json:"version"`
+	SavedAt time.Time `json:"savedAt"`
+	Message string    `json:"message,omitempty"`
+}
+
+// ErrModNotFound is returned when the library has no such mod or version.
+var ErrModNotFound = errors.New("not found in the mod library")
+
+var libraryMu sync.Mutex
+
+func versionPath(key string, version int) string {
+	return filepath.Join(modDataDir, key, fmt.Sprintf("v%06d.json", version))
+}
+
+// modVersions returns the saved versions of a mod in ascending order.
+func modVersions(key string) ([]int, error) {
+	if !modKeyPattern.MatchString(key) {
+		return nil, ErrModNotFound
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(modDataDir, key))
+	if os.IsNotExist(err) {
+		return nil, ErrModNotFound
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to read main.go template: %w", err)
+		return nil, err
 	}
-	templateCode := string(templateBytes)
+	var versions []int
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, "v") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		if v, err := strconv.Atoi(strings.TrimSuffix(name[1:], ".json")); err == nil && v > 0 {
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, ErrModNotFound
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+func readStoredMod(key string, version int) (*StoredMod, error) {
+	data, err := ioutil.ReadFile(versionPath(key, version))
+	if os.IsNotExist(err) {
+		return nil, ErrModNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored StoredMod
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("corrupt library entry %s v%d: %w", key, version, err)
+	}
+	return &stored, nil
+}
+
+// loadStoredMod returns a version of a mod, or its latest version when version is 0.
+func loadStoredMod(key string, version int) (*StoredMod, error) {
+	libraryMu.Lock()
+	defer libraryMu.Unlock()
+	if version == 0 {
+		versions, err := modVersions(key)
+		if err != nil {
+			return nil, err
+		}
+		version = versions[len(versions)-1]
+	}
+	if !modKeyPattern.MatchString(key) || version < 0 {
+		return nil, ErrModNotFound
+	}
+	return readStoredMod(key, version)
+}
 
-	finalCode := strings.Replace(templateCode, "// [[USER_MOD_STRATEGIES]]", userCode, 1)
-	registration := `"user_mod": strategyUserMod, /* [[USER_MOD_REGISTRATION]] */`
-	finalCode = strings.Replace(finalCode, "/* [[USER_MOD_REGISTRATION]] */", registration, 1)
+// saveStoredMod stores spec as a new version of its mod. Saving a mod identical to its
+// latest version returns that version instead of creating a new one.
+func saveStoredMod(spec ModSpec, message string) (stored *StoredMod, created bool, err error) {
+	libraryMu.Lock()
+	defer libraryMu.Unlock()
+	next := 1
+	versions, err := modVersions(spec.Key)
+	if err != nil && err != ErrModNotFound {
+		return nil, false, err
+	}
+	if len(versions) > 0 {
+		latest, err := readStoredMod(spec.Key, versions[len(versions)-1])
+		if err != nil {
+			return nil, false, err
+		}
+		oldJSON, _ := json.Marshal(latest.ModSpec)
+		newJSON, _ := json.Marshal(spec)
+		if bytes.Equal(oldJSON, newJSON) {
+			return latest, false, nil
+		}
+		next = latest.Version + 1
+	}
 
-	buildDir, err := ioutil.TempDir("", "ganymede-validate-")
+	stored = &StoredMod{ModSpec: spec, Version: next, SavedAt: time.Now().UTC(), Message: message}
+	data, err := json.MarshalIndent(stored, "", "  ")
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp validation directory: %w", err)
+		return nil, false, err
 	}
-	defer os.RemoveAll(buildDir)
+	if err := os.MkdirAll(filepath.Join(modDataDir, spec.Key), 0755); err != nil {
+		return nil, false, fmt.Errorf("failed to create library directory: %w", err)
+	}
+	path := versionPath(spec.Key, next)
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return nil, false, fmt.Errorf("failed to save mod: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return nil, false, fmt.Errorf("failed to save mod: %w", err)
+	}
+	return stored, true, nil
+}
 
-	if err := ioutil.WriteFile(filepath.Join(buildDir, "main.go"), []byte(finalCode), 0644); err != nil {
-		return "", fmt.Errorf("failed to write temp go file: %w", err)
+// deleteStoredMod removes a mod and its whole version history.
+func deleteStoredMod(key string) error {
+	libraryMu.Lock()
+	defer libraryMu.Unlock()
+	if _, err := modVersions(key); err != nil {
+		return err
 	}
+	return os.RemoveAll(filepath.Join(modDataDir, key))
+}
 
-	// We compile to a dummy output path within the temp directory.
-	cmd := exec.Command("go", "build", "-o", filepath.Join(buildDir, "output.wasm"), "main.go")
-	cmd.Dir = buildDir
-	cmd.Env = append(os.Environ(), "GOOS=js", "GOARCH=wasm")
+// listLibrary summarises every mod in the library, sorted by key.
+func listLibrary() ([]LibraryEntry, error) {
+	libraryMu.Lock()
+	defer libraryMu.Unlock()
+	dirs, err := ioutil.ReadDir(modDataDir)
+	if os.IsNotExist(err) {
+		return []LibraryEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]LibraryEntry, 0, len(dirs))
+	for _, dir := range dirs {
+		versions, err := modVersions(dir.Name())
+		if err != nil {
+			continue
+		}
+		latest, err := readStoredMod(dir.Name(), versions[len(versions)-1])
+		if err != nil {
+			log.Printf("Skipping library entry %s: %v", dir.Name(), err)
+			continue
+		}
+		entries = append(entries, LibraryEntry{Key: latest.Key, Name: latest.Name, Description: latest.Description, LatestVersion: latest.Version, UpdatedAt: latest.SavedAt})
+	}
+	return entries, nil
+}
 
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	return stderr.String(), cmd.Run()
+// modHistory lists the versions of a mod, newest first.
+func modHistory(key string) ([]ModVersion, error) {
+	libraryMu.Lock()
+	defer libraryMu.Unlock()
+	versions, err := modVersions(key)
+	if err != nil {
+		return nil, err
+	}
+	history := make([]ModVersion, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		stored, err := readStoredMod(key, versions[i])
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, ModVersion{Version: stored.Version, SavedAt: stored.SavedAt, Message: stored.Message})
+	}
+	return history, nil
 }
 
-func compileHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func libraryError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrModNotFound) {
+		http.Error(w, "Mod not found", http.StatusNotFound)
 		return
 	}
+	log.Printf("Mod library error: %v", err)
+	http.Error(w, "Mod library error", http.StatusInternalServerError)
+}
 
-	var req CompileRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+// libraryHandler serves the mod library:
+//
+//	GET    /library                      list mods
+//	GET    /library/{key}                latest version
+//	PUT    /library/{key}                save a new version (ModSpec plus optional "message")
+//	DELETE /library/{key}                delete the mod and its history
+//	GET    /library/{key}/versions       version history
+//	GET    /library/{key}/versions/{n}   a specific version
+func libraryHandler(w http.ResponseWriter, r *http.Request) {
+	var parts []string
+	if rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/library"), "/"); rest != "" {
+		parts = strings.Split(rest, "/")
 	}
 
-	log.Println("Received compilation request...")
-	wasmURL, err := compileAndBuild(req.Code)
-	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case len(parts) == 0:
+		if r.Method != http.MethodGet {
+			http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		entries, err := listLibrary()
+		if err != nil {
+			libraryError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, entries)
+
+	case len(parts) == 1:
+		key := parts[0]
+		switch r.Method {
+		case http.MethodGet:
+			stored, err := loadStoredMod(key, 0)
+			if err != nil {
+				libraryError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, stored)
+		case http.MethodPut, http.MethodPost:
+			var body StoredMod
+			if !decodeBody(w, r, &body) {
+				return
+			}
+			body.Key = key
+			if body.Name == "" {
+				body.Name = key
+			}
+			// Drafts that don't compile yet may be saved; only the metadata is checked.
+			templateBytes, err := readTemplate()
+			if err != nil {
+				libraryError(w, err)
+				return
+			}
+			syms, err := loadTemplateSymbols(string(templateBytes))
+			if err != nil {
+				libraryError(w, err)
+				return
+			}
+			if diags := checkModSpec(syms, body.ModSpec); len(diags) > 0 {
+				writeJSON(w, http.StatusBadRequest, errorResponse(&ModError{Diagnostics: diags}))
+				return
+			}
+			stored, created, err := saveStoredMod(body.ModSpec, body.Message)
+			if err != nil {
+				libraryError(w, err)
+				return
+			}
+			if created {
+				log.Printf("Saved mod %s v%d to the library.", stored.Key, stored.Version)
+				writeJSON(w, http.StatusCreated, stored)
+				return
+			}
+			writeJSON(w, http.StatusOK, stored)
+		case http.MethodDelete:
+			if err := deleteStoredMod(key); err != nil {
+				libraryError(w, err)
+				return
+			}
+			log.Printf("Deleted mod %s from the library.", key)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	case parts[1] == "versions" && len(parts) <= 3:
+		if r.Method != http.MethodGet {
+			http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if len(parts) == 2 {
+			history, err := modHistory(parts[0])
+			if err != nil {
+				libraryError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, history)
+			return
+		}
+		version, err := strconv.Atoi(parts[2])
+		if err != nil || version < 1 {
+			http.Error(w, "Invalid version", http.StatusBadRequest)
+			return
+		}
+		stored, err := loadStoredMod(parts[0], version)
+		if err != nil {
+			libraryError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, stored)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Build scheduling. Compile and validate requests become jobs in a bounded queue that a
+// fixed pool of workers drains, so simultaneous requests cannot saturate the machine.
+// Each client is rate limited and may only have a few jobs open at once.
+const (
+	buildQueueSize        = 32
+	maxJobsPerClient      = 4
+	clientBuildsPerMinute = 10
+	clientBuildBurst      = 5
+	jobRetention          = 10 * time.Minute // How long finished jobs stay queryable
+	jobPollTimeout        = 30 * time.Second // Async jobs nobody polls for this long are canceled
+)
+
+// buildWorkers is the number of builds that run at once. Each build already uses up to
+// buildMaxProcs threads.
+var buildWorkers = max(1, runtime.NumCPU()/2)
+
+// Job states.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// BuildJob is a queued or finished compile or validate request, as reported by /jobs.
+type BuildJob struct {
+	ID         string           `json:"id"`
+	Kind       string           `json:"kind"` // "compile", "validate" or "test"
+	Status     string           `json:"status"`
+	Position   int              `json:"position,omitempty"` // 1-based place in the queue while queued
+	QueuedAt   time.Time        `json:"queuedAt"`
+	StartedAt  *time.Time       `json:"startedAt,omitempty"`
+	FinishedAt *time.Time       `json:"finishedAt,omitempty"`
+	Result     *CompileResponse `json:"result,omitempty"`
+
+	client string
+	polled time.Time // Last time the submitter asked after an async job; zero for waited-on jobs
+	run    func(ctx context.Context) CompileResponse
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// ErrQueueFull and ErrTooManyJobs reject a job at submission.
+var (
+	ErrQueueFull   = errors.New("the build queue is full, try again shortly")
+	ErrTooManyJobs = errors.New("too many builds in progress for this client")
+)
+
+// buildScheduler owns the queue and every job that has not yet expired.
+type buildScheduler struct {
+	mu      sync.Mutex
+	ready   *sync.Cond
+	queue   []*BuildJob
+	jobs    map[string]*BuildJob
+	running int
+}
+
+func newBuildScheduler(workers int) *buildScheduler {
+	s := &buildScheduler{jobs: make(map[string]*BuildJob)}
+	s.ready = sync.NewCond(&s.mu)
+	for i := 0; i < workers; i++ {
+		go s.worker()
+	}
+	return s
+}
 
+// submit queues run as a new job for client.
+func (s *buildScheduler) submit(client, kind string, run func(ctx context.Context) CompileResponse) (*BuildJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) >= buildQueueSize {
+		return nil, ErrQueueFull
+	}
+	open := 0
+	for _, job := range s.jobs {
+		if job.client == client && (job.Status == JobQueued || job.Status == JobRunning) {
+			open++
+		}
+	}
+	if open >= maxJobsPerClient {
+		return nil, ErrTooManyJobs
+	}
+
+	id, err := newJobID()
 	if err != nil {
-		log.Printf("Compilation error: %v", err)
-		json.NewEncoder(w).Encode(CompileResponse{Success: false, Error: err.Error()})
-		return
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &BuildJob{
+		ID:       id,
+		Kind:     kind,
+		Status:   JobQueued,
+		QueuedAt: time.Now().UTC(),
+		client:   client,
+		run:      run,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	s.jobs[job.ID] = job
+	s.queue = append(s.queue, job)
+	s.ready.Signal()
+	return job, nil
+}
+
+// newJobID returns a random job ID. IDs cannot be guessed, so the job lookups stay
+// private to the client that submitted them even behind a shared proxy address.
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := cryptorand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (s *buildScheduler) worker() {
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 {
+			s.ready.Wait()
+		}
+		job := s.queue[0]
+		s.queue = s.queue[1:]
+		now := time.Now().UTC()
+		job.Status = JobRunning
+		job.StartedAt = &now
+		s.running++
+		s.mu.Unlock()
+
+		result := job.run(job.ctx)
+
+		s.mu.Lock()
+		s.running--
+		if job.ctx.Err() != nil {
+			s.finish(job, JobCanceled, CompileResponse{Success: false, Error: "build canceled"})
+		} else if result.Success {
+			s.finish(job, JobSucceeded, result)
+		} else {
+			s.finish(job, JobFailed, result)
+		}
+		s.mu.Unlock()
 	}
+}
 
-	log.Printf("Compilation successful. New WASM at: %s", wasmURL)
-	json.NewEncoder(w).Encode(CompileResponse{Success: true, URL: wasmURL})
+// finish records the outcome of a job. The caller holds s.mu.
+func (s *buildScheduler) finish(job *BuildJob, status string, result CompileResponse) {
+	now := time.Now().UTC()
+	job.Status = status
+	job.FinishedAt = &now
+	job.Result = &result
+	job.cancel()
+	close(job.done)
 }
 
-func validateHandler(w http.ResponseWriter, r *http.Request) {
+// cancelJob stops a job submitted by client. A queued job is dropped from the queue; a
+// running job has its go tool killed and finishes as canceled shortly after.
+func (s *buildScheduler) cancelJob(client, id string) (*BuildJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok || job.client != client {
+		return nil, false
+	}
+	s.cancel(job)
+	return job, true
+}
+
+// cancel stops job. The caller holds s.mu.
+func (s *buildScheduler) cancel(job *BuildJob) {
+	switch job.Status {
+	case JobQueued:
+		for i, queued := range s.queue {
+			if queued == job {
+				s.queue = append(s.queue[:i], s.queue[i+1:]...)
+				break
+			}
+		}
+		s.finish(job, JobCanceled, CompileResponse{Success: false, Error: "build canceled"})
+	case JobRunning:
+		job.cancel()
+	}
+}
+
+// poll is snapshot for the submitter of an async job, which also records that someone
+// is still waiting for it.
+func (s *buildScheduler) poll(client, id string) (BuildJob, bool) {
+	s.mu.Lock()
+	if job, ok := s.jobs[id]; ok && job.client == client {
+		job.polled = time.Now()
+	}
+	s.mu.Unlock()
+	return s.snapshot(client, id)
+}
+
+// cancelAbandoned cancels the async jobs that have gone unpolled for jobPollTimeout,
+// such as those of a page that was closed mid-build.
+func (s *buildScheduler) cancelAbandoned() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.FinishedAt == nil && !job.polled.IsZero() && time.Since(job.polled) > jobPollTimeout {
+			log.Printf("Nobody is polling %s job %s, canceling it.", job.Kind, job.ID)
+			s.cancel(job)
+		}
+	}
+}
+
+// snapshot returns a copy of a job submitted by client that is safe to encode. Other
+// clients' jobs are reported as missing.
+func (s *buildScheduler) snapshot(client, id string) (BuildJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok || job.client != client {
+		return BuildJob{}, false
+	}
+	snap := BuildJob{ID: job.ID, Kind: job.Kind, Status: job.Status, QueuedAt: job.QueuedAt, StartedAt: job.StartedAt, FinishedAt: job.FinishedAt, Result: job.Result}
+	if job.Status == JobQueued {
+		for i, queued := range s.queue {
+			if queued == job {
+				snap.Position = i + 1
+			}
+		}
+	}
+	return snap, true
+}
+
+// QueueStats summarises the scheduler for /jobs.
+type QueueStats struct {
+	Workers int `json:"workers"`
+	Running int `json:"running"`
+	Queued  int `json:"queued"`
+}
+
+func (s *buildScheduler) stats() QueueStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return QueueStats{Workers: buildWorkers, Running: s.running, Queued: len(s.queue)}
+}
+
+// expire forgets jobs that finished more than jobRetention ago.
+func (s *buildScheduler) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, job := range s.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > jobRetention {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+var scheduler *buildScheduler
+
+// clientLimiter is a token bucket per client: clientBuildBurst builds at once, refilled
+// at clientBuildsPerMinute.
+type clientLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+var buildLimiter = &clientLimiter{buckets: make(map[string]*tokenBucket)}
+
+// allow takes a token for client, or reports how long until one is available.
+func (l *clientLimiter) allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	rate := float64(clientBuildsPerMinute) / 60 // Tokens per second
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: clientBuildBurst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(clientBuildBurst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// expire drops buckets that have refilled completely, which behave like new ones.
+func (l *clientLimiter) expire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	full := time.Duration(float64(clientBuildBurst) / clientBuildsPerMinute * float64(time.Minute))
+	for client, b := range l.buckets {
+		if time.Since(b.last) > full {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// clientID identifies the caller for rate limiting.
+func clientID(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// serveBuild runs a compile or validate request through the scheduler. By default it
+// waits for the result and cancels the build if the client goes away; with ?async=1 it
+// answers 202 with the job, which the client then polls at /jobs/{id}. An async job
+// that goes unpolled for jobPollTimeout is canceled.
+func serveBuild(w http.ResponseWriter, r *http.Request, kind string, run func(ctx context.Context, req *CompileRequest, specs []ModSpec) CompileResponse) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req CompileRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	specs, err := req.specs()
+	if err != nil {
+		writeJSON(w, http.StatusOK, errorResponse(err))
 		return
 	}
 
-	log.Println("Received validation request...")
-	compilerOutput, err := validateCode(req.Code)
-	w.Header().Set("Content-Type", "application/json")
+	client := clientID(r)
+	if ok, wait := buildLimiter.allow(client); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeJSON(w, http.StatusTooManyRequests, CompileResponse{Success: false, Error: "too many builds, slow down"})
+		return
+	}
+	job, err := scheduler.submit(client, kind, func(ctx context.Context) CompileResponse { return run(ctx, &req, specs) })
+	if err != nil {
+		switch err {
+		case ErrQueueFull:
+			w.Header().Set("Retry-After", "5")
+			writeJSON(w, http.StatusServiceUnavailable, CompileResponse{Success: false, Error: err.Error()})
+		case ErrTooManyJobs:
+			w.Header().Set("Retry-After", "5")
+			writeJSON(w, http.StatusTooManyRequests, CompileResponse{Success: false, Error: err.Error()})
+		default:
+			writeJSON(w, http.StatusInternalServerError, CompileResponse{Success: false, Error: err.Error()})
+		}
+		return
+	}
+	log.Printf("Queued %s job %s for %s.", kind, job.ID, client)
+
+	if async, _ := strconv.ParseBool(r.URL.Query().Get("async")); async {
+		snap, _ := scheduler.poll(client, job.ID)
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, snap)
+		return
+	}
+	select {
+	case <-job.done:
+		snap, _ := scheduler.snapshot(client, job.ID)
+		writeJSON(w, http.StatusOK, snap.Result)
+	case <-r.Context().Done():
+		log.Printf("Client went away, canceling %s job %s.", kind, job.ID)
+		scheduler.cancelJob(client, job.ID)
+	}
+}
+
+func compileHandler(w http.ResponseWriter, r *http.Request) {
+	serveBuild(w, r, "compile", func(ctx context.Context, _ *CompileRequest, specs []ModSpec) CompileResponse {
+		log.Println("Received compilation request...")
+		resp, err := compileAndBuild(ctx, specs)
+		if err != nil {
+			log.Printf("Compilation error: %v", err)
+			return errorResponse(err)
+		}
+		if resp.Cached {
+			log.Printf("Mods unchanged. Reusing WASM at: %s", resp.URL)
+		} else {
+			log.Printf("Compilation successful. New WASM at: %s", resp.URL)
+		}
+		return *resp
+	})
+}
+
+func validateHandler(w http.ResponseWriter, r *http.Request) {
+	serveBuild(w, r, "validate", func(ctx context.Context, _ *CompileRequest, specs []ModSpec) CompileResponse {
+		log.Println("Received validation request...")
+		warnings, err := validateCode(ctx, specs)
+		if err != nil {
+			log.Printf("Validation failed:\n%v", err)
+			return errorResponse(err)
+		}
+		log.Println("Validation successful.")
+		return CompileResponse{Success: true, Diagnostics: warnings}
+	})
+}
+
+func testHandler(w http.ResponseWriter, r *http.Request) {
+	serveBuild(w, r, "test", func(ctx context.Context, req *CompileRequest, specs []ModSpec) CompileResponse {
+		log.Println("Received test request...")
+		results, err := testMods(ctx, specs, req.Test)
+		if err != nil {
+			log.Printf("Mod tests failed:\n%v", err)
+			return errorResponse(err)
+		}
+		log.Printf("Ran %d mod test(s).", len(results))
+		return CompileResponse{Success: true, Tests: results}
+	})
+}
+
+// jobsHandler reports build jobs:
+//
+//	GET    /jobs        queue statistics
+//	GET    /jobs/{id}   a job's status, with its result once finished
+//	DELETE /jobs/{id}   cancel a job
+//
+// Jobs are only visible to the client that submitted them; anyone else gets a 404.
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs"), "/")
+	if id == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, scheduler.stats())
+		return
+	}
+
+	client := clientID(r)
+	switch r.Method {
+	case http.MethodGet:
+		snap, ok := scheduler.poll(client, id)
+		if !ok {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, snap)
+	case http.MethodDelete:
+		if _, ok := scheduler.cancelJob(client, id); !ok {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		snap, _ := scheduler.snapshot(client, id)
+		writeJSON(w, http.StatusOK, snap)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
 
+// modsHandler lists the compiled modules that are still available.
+func modsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	artifactMu.Lock()
+	artifacts, err := listArtifacts()
+	artifactMu.Unlock()
 	if err != nil {
-		log.Printf("Validation failed:\n%s", compilerOutput)
-		json.NewEncoder(w).Encode(CompileResponse{Success: false, Error: compilerOutput})
+		http.Error(w, "Failed to list modules", http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(artifacts)
+}
+
+// ServerConfig holds the settings for hosting the server. Each one can be given as a
+// flag or through the CRYPTOBOT_* environment variable named in its usage text; flags win.
+type ServerConfig struct {
+	Addr        string
+	TLSCert     string
+	TLSKey      string
+	StaticDir   string   // Directory served at /; empty serves only the application files
+	Token       string   // Bearer token required by the API endpoints
+	BasicAuth   string   // "user:password" accepted by the API endpoints
+	CORSOrigins []string // Origins allowed to call the API from another site; "*" allows any
+}
+
+// appFiles are the files served from the working directory when no static root is set, so
+// that the server source, the mod library and anything else lying around stay private.
+var appFiles = map[string]bool{
+	"crypto-bot.html": true,
+	"scripts.js":      true,
+	"style.css":       true,
+	"wasm_exec.js":    true,
+	"main.wasm":       true,
+	"main.go":         true, // The template the mod editor shows
+}
+
+// envOr returns the environment variable name, or def when it is unset.
+func envOr(name, def string) string {
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	return def
+}
+
+func loadConfig() (*ServerConfig, error) {
+	cfg := &ServerConfig{}
+	var origins string
+	flag.StringVar(&cfg.Addr, "addr", envOr("CRYPTOBOT_ADDR", ":8080"), "listen address (CRYPTOBOT_ADDR)")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", envOr("CRYPTOBOT_TLS_CERT", ""), "TLS certificate file; serves HTTPS with -tls-key (CRYPTOBOT_TLS_CERT)")
+	flag.StringVar(&cfg.TLSKey, "tls-key", envOr("CRYPTOBOT_TLS_KEY", ""), "TLS private key file (CRYPTOBOT_TLS_KEY)")
+	flag.StringVar(&cfg.StaticDir, "static", envOr("CRYPTOBOT_STATIC", ""), "directory to serve at /; by default only the application files are served (CRYPTOBOT_STATIC)")
+	flag.StringVar(&cfg.Token, "token", envOr("CRYPTOBOT_TOKEN", ""), "bearer token required by the API endpoints (CRYPTOBOT_TOKEN)")
+	flag.StringVar(&cfg.BasicAuth, "basic-auth", envOr("CRYPTOBOT_BASIC_AUTH", ""), "user:password accepted by the API endpoints (CRYPTOBOT_BASIC_AUTH)")
+	flag.StringVar(&origins, "cors-origins", envOr("CRYPTOBOT_CORS_ORIGINS", ""), "comma-separated origins allowed to call the API, or * (CRYPTOBOT_CORS_ORIGINS)")
+	flag.Parse()
+
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return nil, errors.New("-tls-cert and -tls-key must be given together")
+	}
+	if cfg.BasicAuth != "" && !strings.Contains(cfg.BasicAuth, ":") {
+		return nil, errors.New("-basic-auth must have the form user:password")
+	}
+	if cfg.StaticDir != "" {
+		if info, err := os.Stat(cfg.StaticDir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("static root %q is not a directory", cfg.StaticDir)
+		}
+	}
+	for _, origin := range strings.Split(origins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			cfg.CORSOrigins = append(cfg.CORSOrigins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	return cfg, nil
+}
+
+// staticHandler serves the web application. With a static root it serves that directory,
+// minus dotfiles; otherwise only appFiles from the working directory. Compiled modules
+// are served from artifactDir at /public/ either way.
+func staticHandler(cfg *ServerConfig) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/public/", http.StripPrefix("/public/", http.FileServer(http.Dir(artifactDir))))
+	if cfg.StaticDir != "" {
+		files := http.FileServer(http.Dir(cfg.StaticDir))
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			for _, part := range strings.Split(r.URL.Path, "/") {
+				if strings.HasPrefix(part, ".") {
+					http.NotFound(w, r)
+					return
+				}
+			}
+			files.ServeHTTP(w, r)
+		})
+		return mux
+	}
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		if name == "" {
+			http.Redirect(w, r, "/crypto-bot.html", http.StatusFound)
+			return
+		}
+		if !appFiles[name] {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, name)
+	})
+	return mux
+}
+
+// requireAuth guards the API endpoints with the configured bearer token and/or basic
+// auth credentials. Either one is accepted when both are set.
+func requireAuth(cfg *ServerConfig, next http.Handler) http.Handler {
+	if cfg.Token == "" && cfg.BasicAuth == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions { // CORS preflight requests carry no credentials
+			next.ServeHTTP(w, r)
+			return
+		}
+		if cfg.Token != "" {
+			if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && secureEqual(token, cfg.Token) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if cfg.BasicAuth != "" {
+			if user, pass, ok := r.BasicAuth(); ok && secureEqual(user+":"+pass, cfg.BasicAuth) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if cfg.BasicAuth != "" {
+			w.Header().Add("WWW-Authenticate", `Basic realm="crypto-bot"`)
+		}
+		if cfg.Token != "" {
+			w.Header().Add("WWW-Authenticate", `Bearer realm="crypto-bot"`)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
 
-	log.Println("Validation successful.")
-	json.NewEncoder(w).Encode(CompileResponse{Success: true})
+// withCORS lets the configured origins call the API from the browser and answers their
+// preflight requests. Only origins listed by name may send credentials; "*" admits any
+// other origin without them, so it still works with a bearer token but never with the
+// browser's stored basic auth credentials.
+func withCORS(cfg *ServerConfig, next http.Handler) http.Handler {
+	if len(cfg.CORSOrigins) == 0 {
+		return next
+	}
+	listed := make(map[string]bool)
+	anyOrigin := false
+	for _, o := range cfg.CORSOrigins {
+		if o == "*" {
+			anyOrigin = true
+		} else {
+			listed[o] = true
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		switch {
+		case origin == "":
+			next.ServeHTTP(w, r)
+			return
+		case listed[origin]:
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		case anyOrigin:
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Expose-Headers", "Location, Retry-After")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func main() {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	if err := os.MkdirAll(artifactDir, 0755); err != nil {
+		log.Fatalf("Failed to create %s: %v", artifactDir, err)
+	}
+	scheduler = newBuildScheduler(buildWorkers)
+	log.Printf("Running up to %d build(s) at once.", buildWorkers)
+
+	// Prune on startup, then keep pruning in the background for long-running servers.
+	pruneArtifacts()
+	go func() {
+		for range time.Tick(artifactGCInterval) {
+			pruneArtifacts()
+		}
+	}()
+	go func() {
+		for range time.Tick(time.Minute) {
+			scheduler.expire()
+			buildLimiter.expire()
+		}
+	}()
+	go func() {
+		for range time.Tick(jobPollTimeout / 2) {
+			scheduler.cancelAbandoned()
+		}
+	}()
+
 	// This server will handle API calls and serve static files.
 	mux := http.NewServeMux()
-	mux.HandleFunc("/compile", compileHandler)
-	mux.HandleFunc("/validate", validateHandler)
-	mux.Handle("/", http.FileServer(http.Dir("."))) // Serves all project files
+	api := func(path string, handler http.HandlerFunc) {
+		mux.Handle(path, withCORS(cfg, requireAuth(cfg, handler)))
+	}
+	api("/compile", compileHandler)
+	api("/validate", validateHandler)
+	api("/test", testHandler)
+	api("/jobs", jobsHandler)
+	api("/jobs/", jobsHandler)
+	api("/mods", modsHandler)
+	api("/library", libraryHandler)
+	api("/library/", libraryHandler)
+	mux.Handle("/", staticHandler(cfg))
 
-	log.Println("Starting server on :8080...")
-	log.Println("Visit http://localhost:8080/crypto-bot.html to use the application.")
-	if err := http.ListenAndServe(":8080", mux); err != nil {
+	server := &http.Server{Addr: cfg.Addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	scheme := "http"
+	if cfg.TLSCert != "" {
+		scheme = "https"
+	}
+	if cfg.StaticDir != "" {
+		log.Printf("Serving static files from %s.", cfg.StaticDir)
+	}
+	if cfg.Token != "" || cfg.BasicAuth != "" {
+		log.Println("API endpoints require authentication.")
+	}
+	host := cfg.Addr
+	if strings.HasPrefix(host, ":") {
+		host = "localhost" + host
+	}
+	log.Printf("Starting server on %s...", cfg.Addr)
+	log.Printf("Visit %s://%s/crypto-bot.html to use the application.", scheme, host)
+	if cfg.TLSCert != "" {
+		err = server.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
\ No newline at end of file